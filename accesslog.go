@@ -0,0 +1,162 @@
+package main
+
+import (
+	"io"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var accessLogFormat = "text"
+var accessLogQuiet, accessLogVerbose bool
+var accessLogFile *reopenableFile
+var accessLog = log.New(os.Stderr, "", log.LstdFlags)
+var accessJSONLog = slog.New(slog.NewJSONHandler(os.Stderr, nil))
+
+// trustProxy makes clientIP believe X-Forwarded-For and X-Real-IP. It is
+// only safe when every request arrives through a proxy that sets them.
+var trustProxy bool
+
+type reopenableFile struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File
+}
+
+func openReopenableFile(path string) (*reopenableFile, error) {
+	rf := &reopenableFile{path: path}
+	if err := rf.Reopen(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+func (rf *reopenableFile) Write(b []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	return rf.f.Write(b)
+}
+
+func (rf *reopenableFile) Reopen() error {
+	f, err := os.OpenFile(rf.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.f != nil {
+		rf.f.Close()
+	}
+	rf.f = f
+	return nil
+}
+
+func initAccessLog(logFile, format string) {
+	switch format {
+	case "text", "common", "json":
+	default:
+		log.Fatalf("Error: unknown --logformat %q (expected text, common or json)", format)
+	}
+	accessLogFormat = format
+
+	var out io.Writer = os.Stderr
+	if logFile != "" {
+		f, err := openReopenableFile(logFile)
+		if err != nil {
+			log.Fatalf("Error opening log file: %v", err)
+		}
+		accessLogFile = f
+		out = f
+	}
+
+	flags := log.LstdFlags
+	if format != "text" {
+		flags = 0
+	}
+	accessLog = log.New(out, "", flags)
+	accessJSONLog = slog.New(slog.NewJSONHandler(out, nil))
+}
+
+func shouldLogAccess(path string) bool {
+	if accessLogQuiet {
+		return false
+	}
+	switch path {
+	case "/", "/favicon.ico", "/healthz", "/readyz":
+		return accessLogVerbose
+	}
+	return true
+}
+
+func logAccess(r *http.Request, status int, bytes int64, start time.Time, duration, ttfb time.Duration) {
+	requestID := requestIDFrom(r.Context())
+
+	switch accessLogFormat {
+	case "common":
+		accessLog.Printf("%s - - [%s] \"%s %s %s\" %d %d %s ttfb=%s %s",
+			clientIP(r), start.Format("02/Jan/2006:15:04:05 -0700"), r.Method, r.URL.RequestURI(), r.Proto, status, bytes, duration, ttfb, requestID)
+	case "json":
+		accessJSONLog.LogAttrs(r.Context(), slog.LevelInfo, "request",
+			slog.String("remote_addr", clientIP(r)),
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", status),
+			slog.Int64("bytes", bytes),
+			slog.Float64("duration_ms", float64(duration.Microseconds())/1000),
+			slog.Float64("ttfb_ms", float64(ttfb.Microseconds())/1000),
+			slog.String("request_id", requestID),
+		)
+	default:
+		accessLog.Println(clientIP(r), r.Method, r.URL.Path, status, bytes, duration, "ttfb="+ttfb.String(), requestID)
+	}
+}
+
+func clientIP(r *http.Request) string {
+	if trustProxy {
+		if ip := forwardedIP(r); ip != "" {
+			return ip
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// forwardedIP picks the client address out of the proxy headers. In
+// X-Forwarded-For each proxy appends the address it received the request
+// from, so the list is walked from the right and private or loopback hops,
+// which are our own proxies, are skipped. If every entry is private, the
+// leftmost one is the client.
+func forwardedIP(r *http.Request) string {
+	var hops []netip.Addr
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		for _, part := range strings.Split(header, ",") {
+			if addr, err := netip.ParseAddr(strings.TrimSpace(part)); err == nil {
+				hops = append(hops, addr.Unmap())
+			}
+		}
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		if !hops[i].IsPrivate() && !hops[i].IsLoopback() {
+			return hops[i].String()
+		}
+	}
+	if len(hops) > 0 {
+		return hops[0].String()
+	}
+
+	if addr, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+		return addr.Unmap().String()
+	}
+	return ""
+}
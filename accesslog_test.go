@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClientIPTrustProxy(t *testing.T) {
+	defer func(saved bool) { trustProxy = saved }(trustProxy)
+
+	cases := []struct {
+		name         string
+		forwarded    []string
+		realIP       string
+		want, direct string
+	}{
+		{"no headers", nil, "", "192.0.2.10", "192.0.2.10"},
+		{"single hop", []string{"203.0.113.5"}, "", "203.0.113.5", "192.0.2.10"},
+		{"rightmost public hop", []string{"198.51.100.1, 203.0.113.5, 10.0.0.2"}, "", "203.0.113.5", "192.0.2.10"},
+		{"repeated headers", []string{"198.51.100.1", "203.0.113.5"}, "", "203.0.113.5", "192.0.2.10"},
+		{"only private hops", []string{"10.0.0.1, 10.0.0.2"}, "", "10.0.0.1", "192.0.2.10"},
+		{"garbage is ignored", []string{"not-an-ip"}, "203.0.113.9", "203.0.113.9", "192.0.2.10"},
+		{"X-Real-IP", nil, "::ffff:203.0.113.9", "203.0.113.9", "192.0.2.10"},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "192.0.2.10:4321"
+		for _, v := range c.forwarded {
+			req.Header.Add("X-Forwarded-For", v)
+		}
+		if c.realIP != "" {
+			req.Header.Set("X-Real-IP", c.realIP)
+		}
+
+		trustProxy = true
+		if got := clientIP(req); got != c.want {
+			t.Errorf("%s: trusted clientIP = %q, want %q", c.name, got, c.want)
+		}
+		trustProxy = false
+		if got := clientIP(req); got != c.direct {
+			t.Errorf("%s: untrusted clientIP = %q, want %q", c.name, got, c.direct)
+		}
+	}
+}
+
+func TestJSONAccessLog(t *testing.T) {
+	defer func(format string, logger *slog.Logger) {
+		accessLogFormat, accessJSONLog = format, logger
+	}(accessLogFormat, accessJSONLog)
+	var buf bytes.Buffer
+	accessLogFormat = "json"
+	accessJSONLog = slog.New(slog.NewJSONHandler(&buf, nil))
+	_, cfg := newTestConfig(t)
+	r := newRouter(cfg)
+
+	serveRouter(r, http.MethodGet, "/static/a.txt", "192.0.2.7:1234")
+	serveRouter(r, http.MethodGet, "/static/missing.txt", "192.0.2.7:1234")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d log lines, want 2:\n%s", len(lines), buf.String())
+	}
+	for i, want := range []struct {
+		path   string
+		status float64
+	}{{"/static/a.txt", 200}, {"/static/missing.txt", 404}} {
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(lines[i]), &entry); err != nil {
+			t.Fatalf("line %d is not JSON: %v\n%s", i, err, lines[i])
+		}
+		if entry["method"] != "GET" || entry["path"] != want.path || entry["status"] != want.status || entry["remote_addr"] != "192.0.2.7" {
+			t.Errorf("line %d = %v, want GET %s %v from 192.0.2.7", i, entry, want.path, want.status)
+		}
+		if _, ok := entry["duration_ms"].(float64); !ok {
+			t.Errorf("line %d: duration_ms = %v, want a number", i, entry["duration_ms"])
+		}
+	}
+}
+
+func TestAccessLogLevels(t *testing.T) {
+	defer func(quiet, verbose bool) { accessLogQuiet, accessLogVerbose = quiet, verbose }(accessLogQuiet, accessLogVerbose)
+	var buf bytes.Buffer
+	accessLog.SetOutput(&buf)
+	defer accessLog.SetOutput(io.Discard)
+	_, cfg := newTestConfig(t)
+	r := newRouter(cfg)
+
+	cases := []struct {
+		name           string
+		quiet, verbose bool
+		wantLines      int
+	}{
+		{"--quiet", true, false, 0},
+		{"default", false, false, 1},
+		{"--verbose", false, true, 5},
+	}
+	for _, c := range cases {
+		accessLogQuiet, accessLogVerbose = c.quiet, c.verbose
+		buf.Reset()
+		for _, target := range []string{"/static/a.txt", "/", "/favicon.ico", "/healthz", "/readyz"} {
+			serveRouter(r, http.MethodGet, target, "")
+		}
+		if got := strings.Count(buf.String(), "\n"); got != c.wantLines {
+			t.Errorf("%s: %d access log lines, want %d:\n%s", c.name, got, c.wantLines, buf.String())
+		}
+	}
+}
+
+func TestQuietAndVerboseConflict(t *testing.T) {
+	out, err := runMain(t, "--directory", t.TempDir(), "--quiet", "--verbose")
+	if err == nil || !strings.Contains(out, "--quiet and --verbose cannot be used together") {
+		t.Errorf("--quiet --verbose: err %v, output %q; want a clear error", err, out)
+	}
+}
+
+func TestAccessLogTiming(t *testing.T) {
+	defer func(format string, logger *slog.Logger) {
+		accessLogFormat, accessJSONLog = format, logger
+	}(accessLogFormat, accessJSONLog)
+	var buf bytes.Buffer
+	accessLogFormat = "json"
+	accessJSONLog = slog.New(slog.NewJSONHandler(&buf, nil))
+
+	const delay = 50 * time.Millisecond
+	r := newTestRouter(loggingMiddleware)
+	r.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		w.Write([]byte("first"))
+		time.Sleep(delay)
+		w.Write([]byte("second"))
+	})
+	serveRouter(r, http.MethodGet, "/slow", "")
+
+	var entry struct {
+		TTFB     float64 `json:"ttfb_ms"`
+		Duration float64 `json:"duration_ms"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("%v: %s", err, buf.String())
+	}
+	ms := float64(delay.Milliseconds())
+	if entry.TTFB < ms || entry.TTFB >= entry.Duration {
+		t.Errorf("ttfb_ms = %v with duration_ms %v, want at least %v and less than the duration", entry.TTFB, entry.Duration, ms)
+	}
+	if entry.Duration < 2*ms || entry.Duration > 20*ms {
+		t.Errorf("duration_ms = %v, want about %v", entry.Duration, 2*ms)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func loadAuth(spec string) (map[string]string, error) {
+	if _, err := os.Stat(spec); err == nil {
+		return loadHtpasswd(spec)
+	}
+
+	user, pass, ok := strings.Cut(spec, ":")
+	if !ok || user == "" {
+		return nil, fmt.Errorf("expected user:pass or a path to an htpasswd file, got %q", spec)
+	}
+	return map[string]string{user: pass}, nil
+}
+
+func loadHtpasswd(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	users := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		user, hash, ok := strings.Cut(text, ":")
+		if !ok || user == "" {
+			return nil, fmt.Errorf("%s:%d: malformed entry", path, line)
+		}
+		if strings.HasPrefix(hash, "$apr1$") || strings.HasPrefix(hash, "$1$") {
+			return nil, fmt.Errorf("%s:%d: MD5 hashes are not supported, use bcrypt (htpasswd -B)", path, line)
+		}
+		users[user] = hash
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return nil, fmt.Errorf("%s: no users defined", path)
+	}
+	return users, nil
+}
+
+func checkPassword(stored, given string) bool {
+	switch {
+	case strings.HasPrefix(stored, "$2"):
+		return bcrypt.CompareHashAndPassword([]byte(stored), []byte(given)) == nil
+	case strings.HasPrefix(stored, "{SHA}"):
+		sum := sha1.Sum([]byte(given))
+		return subtle.ConstantTimeCompare([]byte(stored[len("{SHA}"):]), []byte(base64.StdEncoding.EncodeToString(sum[:]))) == 1
+	default:
+		return subtle.ConstantTimeCompare([]byte(stored), []byte(given)) == 1
+	}
+}
+
+func basicAuthMiddleware(users map[string]string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if ok {
+			stored, known := users[user]
+			if checkPassword(stored, pass) && known {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		w.Header().Set("WWW-Authenticate", `Basic realm="Static Server", charset="UTF-8"`)
+		httpError(w, r, http.StatusUnauthorized, "Unauthorized")
+	})
+}
+
+func adminTokenMiddleware(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if ok && subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("WWW-Authenticate", `Bearer realm="Static Server"`)
+		httpError(w, r, http.StatusUnauthorized, "Unauthorized")
+	})
+}
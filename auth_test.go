@@ -0,0 +1,125 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestAuthCoversEveryFileRoute(t *testing.T) {
+	_, cfg := newTestConfig(t)
+	cfg.files.spa = true
+	cfg.authUsers = map[string]string{"u": "p"}
+	r := newRouter(cfg)
+
+	for _, target := range []string{
+		"/",
+		"/app/route",
+		"/static/a.txt",
+		"/integrity?path=/static/a.txt",
+		"/sitemap.xml",
+	} {
+		rec := serveRequest(r, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("anonymous GET %s = %d, want 401", target, rec.Code)
+		}
+		if authed := serveRequest(r, newAuthRequest(target, "u", "p")); authed.Code != http.StatusOK {
+			t.Errorf("authenticated GET %s = %d, want 200", target, authed.Code)
+		}
+	}
+
+	authed := serveRequest(r, newAuthRequest("/app/route", "u", "p"))
+	if authed.Body.String() != "index" {
+		t.Errorf("authenticated GET /app/route = %q, want the SPA index", authed.Body.String())
+	}
+}
+
+func newAuthRequest(target, user, pass string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	req.SetBasicAuth(user, pass)
+	return req
+}
+
+func TestCheckPassword(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("s3cret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha1.Sum([]byte("s3cret"))
+	sha := "{SHA}" + base64.StdEncoding.EncodeToString(sum[:])
+
+	for _, stored := range []string{"s3cret", string(hash), sha} {
+		if !checkPassword(stored, "s3cret") {
+			t.Errorf("checkPassword(%q) rejected the right password", stored)
+		}
+		if checkPassword(stored, "wrong") {
+			t.Errorf("checkPassword(%q) accepted a wrong password", stored)
+		}
+	}
+}
+
+func TestBasicAuthMiddleware(t *testing.T) {
+	h := basicAuthMiddleware(map[string]string{"u": "p"}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+
+	anonymous := serveRequest(h, httptest.NewRequest(http.MethodGet, "/a.txt", nil))
+	if anonymous.Code != http.StatusUnauthorized {
+		t.Errorf("no credentials = %d, want 401", anonymous.Code)
+	}
+	if got := anonymous.Header().Get("WWW-Authenticate"); !strings.HasPrefix(got, "Basic ") {
+		t.Errorf("WWW-Authenticate = %q, want a Basic challenge", got)
+	}
+
+	for _, c := range []struct {
+		user, pass string
+		want       int
+	}{
+		{"u", "p", http.StatusOK},
+		{"u", "wrong", http.StatusUnauthorized},
+		{"nobody", "p", http.StatusUnauthorized},
+		{"", "", http.StatusUnauthorized},
+	} {
+		if rec := serveRequest(h, newAuthRequest("/a.txt", c.user, c.pass)); rec.Code != c.want {
+			t.Errorf("credentials %q:%q = %d, want %d", c.user, c.pass, rec.Code, c.want)
+		}
+	}
+}
+
+func TestLoadAuth(t *testing.T) {
+	users, err := loadAuth("u:p:with:colons")
+	if err != nil || users["u"] != "p:with:colons" {
+		t.Errorf("loadAuth(user:pass) = %v, %v", users, err)
+	}
+	for _, spec := range []string{"nocolon", ":p"} {
+		if _, err := loadAuth(spec); err == nil {
+			t.Errorf("loadAuth(%q) succeeded, want an error", spec)
+		}
+	}
+
+	dir := t.TempDir()
+	htpasswd := filepath.Join(dir, "htpasswd")
+	writeTestFile(t, htpasswd, "# users\nalice:{SHA}abc\n\nbob:$2y$05$abc\n")
+	users, err = loadAuth(htpasswd)
+	if err != nil || len(users) != 2 || users["alice"] != "{SHA}abc" || users["bob"] != "$2y$05$abc" {
+		t.Errorf("loadAuth(htpasswd) = %v, %v", users, err)
+	}
+
+	for name, content := range map[string]string{
+		"md5":       "carol:$apr1$abc$def\n",
+		"malformed": "nocolon\n",
+		"empty":     "# nobody\n",
+	} {
+		path := filepath.Join(dir, name)
+		writeTestFile(t, path, content)
+		if _, err := loadAuth(path); err == nil {
+			t.Errorf("loadAuth(%s htpasswd) succeeded, want an error", name)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"strings"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+func newAutocertManager(domains, cacheDir string) *autocert.Manager {
+	var hosts []string
+	for _, domain := range strings.Split(domains, ",") {
+		if domain = strings.TrimSpace(domain); domain != "" {
+			hosts = append(hosts, domain)
+		}
+	}
+
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(hosts...),
+		Cache:      autocert.DirCache(cacheDir),
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAutocertManager(t *testing.T) {
+	cacheDir := t.TempDir()
+	m := newAutocertManager(" example.com, www.example.com ,", cacheDir)
+
+	for _, host := range []string{"example.com", "www.example.com"} {
+		if err := m.HostPolicy(context.Background(), host); err != nil {
+			t.Errorf("HostPolicy(%s) = %v, want allowed", host, err)
+		}
+	}
+	if err := m.HostPolicy(context.Background(), "evil.example"); err == nil {
+		t.Error("HostPolicy allowed a domain not in --autocert-domains")
+	}
+
+	// A certificate already in the cache is served without contacting the
+	// ACME directory, which the test has no access to.
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		DNSNames:     []string{"example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cached := append(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	if err := os.WriteFile(filepath.Join(cacheDir, "example.com"), cached, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	hello := &tls.ClientHelloInfo{
+		ServerName:        "example.com",
+		SignatureSchemes:  []tls.SignatureScheme{tls.ECDSAWithP256AndSHA256},
+		SupportedCurves:   []tls.CurveID{tls.CurveP256},
+		SupportedVersions: []uint16{tls.VersionTLS13},
+		CipherSuites:      []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256},
+	}
+	cert, err := m.TLSConfig().GetCertificate(hello)
+	if err != nil {
+		t.Fatalf("GetCertificate(example.com) = %v, want the cached certificate", err)
+	}
+	if cert.Leaf == nil || cert.Leaf.SerialNumber.Cmp(big.NewInt(2)) != 0 {
+		t.Errorf("GetCertificate returned %v, want the cached certificate", cert.Leaf)
+	}
+
+	// Port 80 answers ACME challenges itself and redirects everything else.
+	h := m.HTTPHandler(httpsRedirectHandler("443"))
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/static/a.txt", nil)
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusMovedPermanently || rec.Header().Get("Location") != "https://example.com/static/a.txt" {
+		t.Errorf("GET on port 80 = %d Location %q, want a redirect to HTTPS", rec.Code, rec.Header().Get("Location"))
+	}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://example.com/.well-known/acme-challenge/token", nil))
+	if rec.Code == http.StatusMovedPermanently {
+		t.Error("ACME challenge request was redirected instead of answered by the manager")
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const maxBandwidthChunk = 32 << 10
+
+// bandwidthLimiter is a token bucket of bytes shared by every response, so
+// --max-bandwidth caps the server's total outbound rate rather than the
+// rate of each connection.
+type bandwidthLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	bucket tokenBucket
+}
+
+func newBandwidthLimiter(bytesPerSecond int64) *bandwidthLimiter {
+	burst := math.Min(maxBandwidthChunk, float64(bytesPerSecond))
+	return &bandwidthLimiter{
+		rate:   float64(bytesPerSecond),
+		burst:  burst,
+		bucket: tokenBucket{tokens: burst, last: time.Now()},
+	}
+}
+
+// wait takes n bytes from the bucket, sleeping until the writes queued
+// ahead of it have drained. The bucket may go negative, which is what
+// makes concurrent writers share the rate fairly.
+func (l *bandwidthLimiter) wait(ctx context.Context, n int) error {
+	now := time.Now()
+
+	l.mu.Lock()
+	b := &l.bucket
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	b.tokens -= float64(n)
+	delay := time.Duration(-b.tokens / l.rate * float64(time.Second))
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *bandwidthLimiter) chunkSize() int {
+	return int(l.burst)
+}
+
+// throttledWriter writes the body in chunks no larger than the bucket,
+// waiting on the shared limiter before each one.
+type throttledWriter struct {
+	http.ResponseWriter
+	ctx     context.Context
+	limiter *bandwidthLimiter
+}
+
+func (w *throttledWriter) Write(b []byte) (int, error) {
+	written := 0
+	for len(b) > 0 {
+		chunk := b[:min(len(b), w.limiter.chunkSize())]
+		if err := w.limiter.wait(w.ctx, len(chunk)); err != nil {
+			return written, err
+		}
+		n, err := w.ResponseWriter.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		b = b[n:]
+	}
+	return written, nil
+}
+
+// ReadFrom hands the body to the underlying writer a chunk at a time, so
+// each chunk can still go out with sendfile. The limiter is charged after
+// each chunk for what was actually sent, since the body's length is not
+// known up front.
+func (w *throttledWriter) ReadFrom(src io.Reader) (int64, error) {
+	var written int64
+	for {
+		n, err := io.CopyN(w.ResponseWriter, src, int64(w.limiter.chunkSize()))
+		written += n
+		if err != nil && err != io.EOF {
+			return written, err
+		}
+		if n > 0 {
+			if waitErr := w.limiter.wait(w.ctx, int(n)); waitErr != nil {
+				return written, waitErr
+			}
+		}
+		if err == io.EOF {
+			return written, nil
+		}
+	}
+}
+
+func (w *throttledWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
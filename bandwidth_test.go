@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestThrottledWriterReadFrom(t *testing.T) {
+	// A 64 KiB/s limit with 32 KiB chunks: 96 KiB is three chunks, of which
+	// the burst covers the first, so copying it takes about a second.
+	const rate = 64 << 10
+	data := bytes.Repeat([]byte("x"), 96<<10)
+	under := &readerFromRecorder{ResponseRecorder: httptest.NewRecorder()}
+	w := &throttledWriter{ResponseWriter: under, ctx: context.Background(), limiter: newBandwidthLimiter(rate)}
+
+	start := time.Now()
+	n, err := io.Copy(w, io.LimitReader(bytes.NewReader(data), int64(len(data))))
+	elapsed := time.Since(start)
+	if err != nil || n != int64(len(data)) {
+		t.Fatalf("io.Copy = %d, %v", n, err)
+	}
+	if !bytes.Equal(under.Body.Bytes(), data) {
+		t.Error("body does not match what was copied")
+	}
+	// One call per chunk, plus the empty one that finds the end of the body.
+	if under.readFroms != 4 {
+		t.Errorf("underlying ReadFrom called %d times, want 4", under.readFroms)
+	}
+	if elapsed < 900*time.Millisecond {
+		t.Errorf("96 KiB at 64 KiB/s took %v, want about 1s", elapsed)
+	}
+}
+
+func TestThrottledWriterReadFromCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w := &throttledWriter{ResponseWriter: httptest.NewRecorder(), ctx: ctx, limiter: newBandwidthLimiter(1024)}
+
+	if _, err := io.Copy(w, io.LimitReader(bytes.NewReader(make([]byte, 4096)), 4096)); err != context.Canceled {
+		t.Errorf("io.Copy with a canceled context = %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+func browserCommand(goos, url string) (string, []string) {
+	switch goos {
+	case "darwin":
+		return "open", []string{url}
+	case "windows":
+		return "rundll32", []string{"url.dll,FileProtocolHandler", url}
+	default:
+		return "xdg-open", []string{url}
+	}
+}
+
+func isInteractive() bool {
+	stat, err := os.Stdout.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
+}
+
+func openBrowser(url string) {
+	name, args := browserCommand(runtime.GOOS, url)
+	cmd := exec.Command(name, args...)
+	if err := cmd.Start(); err != nil {
+		log.Printf("Error opening browser: %v", err)
+		return
+	}
+	go cmd.Wait()
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBrowserCommand(t *testing.T) {
+	const url = "http://localhost:3456/"
+	cases := []struct {
+		goos     string
+		wantName string
+		wantArgs []string
+	}{
+		{"darwin", "open", []string{url}},
+		{"windows", "rundll32", []string{"url.dll,FileProtocolHandler", url}},
+		{"linux", "xdg-open", []string{url}},
+		{"freebsd", "xdg-open", []string{url}},
+	}
+	for _, c := range cases {
+		name, args := browserCommand(c.goos, url)
+		if name != c.wantName || !reflect.DeepEqual(args, c.wantArgs) {
+			t.Errorf("browserCommand(%s) = %s %q, want %s %q", c.goos, name, args, c.wantName, c.wantArgs)
+		}
+	}
+}
+
+func TestOpenSkippedWhenNotInteractive(t *testing.T) {
+	// A stand-in for every browser command records that it ran.
+	stubDir := t.TempDir()
+	marker := filepath.Join(stubDir, "opened")
+	for _, name := range []string{"xdg-open", "open", "rundll32"} {
+		script := "#!/bin/sh\necho \"$@\" > " + marker + "\n"
+		if err := os.WriteFile(filepath.Join(stubDir, name), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", stubDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	// The server's stdout is a pipe, so --open must not launch anything,
+	// and startup must not wait on it.
+	startServer(t, "--directory", t.TempDir(), "--open")
+	time.Sleep(200 * time.Millisecond)
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("--open launched a browser without a terminal")
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var defaultCacheMaxAge = map[string]int{
+	"html":  0,
+	"htm":   0,
+	"png":   31536000,
+	"jpg":   31536000,
+	"jpeg":  31536000,
+	"gif":   31536000,
+	"webp":  31536000,
+	"avif":  31536000,
+	"svg":   31536000,
+	"ico":   31536000,
+	"woff":  31536000,
+	"woff2": 31536000,
+	"ttf":   31536000,
+	"otf":   31536000,
+}
+
+func parseCacheControl(spec string) (map[string]int, error) {
+	rules := map[string]int{}
+	for ext, maxAge := range defaultCacheMaxAge {
+		rules[ext] = maxAge
+	}
+
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		ext, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("expected ext=seconds, got %q", pair)
+		}
+		maxAge, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || maxAge < 0 {
+			return nil, fmt.Errorf("invalid max-age in %q", pair)
+		}
+		rules[strings.ToLower(strings.TrimPrefix(strings.TrimSpace(ext), "."))] = maxAge
+	}
+	return rules, nil
+}
+
+func cacheControl(rules map[string]int, name string) string {
+	maxAge, ok := rules[strings.ToLower(strings.TrimPrefix(filepath.Ext(name), "."))]
+	if !ok {
+		return ""
+	}
+	if maxAge == 0 {
+		return "no-cache"
+	}
+	return "public, max-age=" + strconv.Itoa(maxAge)
+}
+
+// setCacheHeaders sets Cache-Control for name and, with emitExpires, the
+// equivalent absolute Expires for proxies that predate Cache-Control.
+func setCacheHeaders(header http.Header, rules map[string]int, name string, emitExpires bool) {
+	cc := cacheControl(rules, name)
+	if cc == "" {
+		return
+	}
+	header.Set("Cache-Control", cc)
+	if emitExpires {
+		maxAge := rules[strings.ToLower(strings.TrimPrefix(filepath.Ext(name), "."))]
+		header.Set("Expires", time.Now().Add(time.Duration(maxAge)*time.Second).UTC().Format(http.TimeFormat))
+	}
+}
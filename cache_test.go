@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCacheControlPerExtension(t *testing.T) {
+	dir, h := newTestSite(t)
+	for _, name := range []string{"logo.png", "site.css", "page.html", "data.bin"} {
+		writeTestFile(t, filepath.Join(dir, name), "x")
+	}
+	rules, err := parseCacheControl("css=86400, .PNG=60")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.cacheRules = rules
+
+	cases := []struct {
+		urlPath, want string
+	}{
+		{"/logo.png", "public, max-age=60"},
+		{"/site.css", "public, max-age=86400"},
+		{"/page.html", "no-cache"},
+		{"/", "no-cache"},
+		{"/data.bin", ""},
+	}
+	for _, c := range cases {
+		if got := serveRaw(h, c.urlPath, nil).Header().Get("Cache-Control"); got != c.want {
+			t.Errorf("GET %s: Cache-Control = %q, want %q", c.urlPath, got, c.want)
+		}
+	}
+}
+
+func TestParseCacheControlDefaults(t *testing.T) {
+	rules, err := parseCacheControl("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cacheControl(rules, "font.woff2"); got != "public, max-age=31536000" {
+		t.Errorf("default for .woff2 = %q, want a year", got)
+	}
+	if got := cacheControl(rules, "index.html"); got != "no-cache" {
+		t.Errorf("default for .html = %q, want no-cache", got)
+	}
+
+	for _, spec := range []string{"css", "css=soon", "css=-1"} {
+		if _, err := parseCacheControl(spec); err == nil {
+			t.Errorf("parseCacheControl(%q) accepted", spec)
+		}
+	}
+}
+
+func TestEmitExpires(t *testing.T) {
+	dir, h := newTestSite(t)
+	for _, name := range []string{"logo.png", "page.html", "data.bin"} {
+		writeTestFile(t, filepath.Join(dir, name), "x")
+	}
+	rules, err := parseCacheControl("png=3600")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.cacheRules = rules
+
+	if got := serveRaw(h, "/logo.png", nil).Header().Get("Expires"); got != "" {
+		t.Errorf("Expires without --emit-expires = %q, want none", got)
+	}
+
+	h.emitExpires = true
+	for _, c := range []struct {
+		urlPath string
+		maxAge  time.Duration
+	}{
+		{"/logo.png", time.Hour},
+		{"/page.html", 0},
+	} {
+		now := time.Now()
+		got := serveRaw(h, c.urlPath, nil).Header().Get("Expires")
+		expires, err := http.ParseTime(got)
+		if err != nil {
+			t.Errorf("GET %s: Expires = %q, want an HTTP date: %v", c.urlPath, got, err)
+			continue
+		}
+		if want := now.Add(c.maxAge); expires.Before(want.Add(-2*time.Second)) || expires.After(want.Add(2*time.Second)) {
+			t.Errorf("GET %s: Expires = %v, want about %v", c.urlPath, expires, want.UTC())
+		}
+	}
+	if got := serveRaw(h, "/data.bin", nil).Header().Get("Expires"); got != "" {
+		t.Errorf("Expires for a file without a cache rule = %q, want none", got)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"os"
+)
+
+func checkDirectory(dir string) error {
+	stat, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !stat.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Readdirnames(1); err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+func runChecks(configFile string, dirs []string, certFile, keyFile, socketPath, addr string) {
+	if configFile != "" {
+		fmt.Println("ok   config file " + configFile)
+	}
+
+	for _, dir := range dirs {
+		if err := checkDirectory(dir); err != nil {
+			fmt.Println("FAIL directory " + dir + ": " + err.Error())
+			os.Exit(1)
+		}
+		fmt.Println("ok   directory " + dir)
+	}
+
+	if certFile != "" {
+		if _, err := tls.LoadX509KeyPair(certFile, keyFile); err != nil {
+			fmt.Println("FAIL TLS certificate: " + err.Error())
+			os.Exit(1)
+		}
+		fmt.Println("ok   TLS certificate " + certFile)
+	}
+
+	ln, err := listen(socketPath, addr)
+	if err != nil {
+		fmt.Println("FAIL listen: " + err.Error())
+		os.Exit(1)
+	}
+	fmt.Println("ok   listen " + ln.Addr().String())
+	ln.Close()
+
+	fmt.Println("Configuration OK")
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	dir, other := t.TempDir(), t.TempDir()
+	certPath, keyPath, _ := writeTestCert(t, other)
+	configPath := filepath.Join(other, "config.json")
+	writeTestFile(t, configPath, `{"quiet": true}`)
+	badConfig := filepath.Join(other, "bad.json")
+	writeTestFile(t, badConfig, `{"quiet": `)
+	badCert := filepath.Join(other, "bad.pem")
+	writeTestFile(t, badCert, "not a certificate")
+	notDir := filepath.Join(other, "file.txt")
+	writeTestFile(t, notDir, "x")
+
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+	_, busyPort, _ := net.SplitHostPort(busy.Addr().String())
+
+	cases := []struct {
+		name string
+		args []string
+		ok   bool
+		want string
+	}{
+		{"valid", []string{"--directory", dir, "--cert", certPath, "--key", keyPath, "--config", configPath}, true, "Configuration OK"},
+		{"missing directory", []string{"--directory", filepath.Join(dir, "missing")}, false, "FAIL directory"},
+		{"not a directory", []string{"--directory", notDir}, false, "is not a directory"},
+		{"bad certificate", []string{"--directory", dir, "--cert", badCert, "--key", keyPath}, false, "FAIL TLS certificate"},
+		{"port in use", []string{"--directory", dir, "--port", busyPort}, false, "FAIL listen"},
+		{"invalid config file", []string{"--directory", dir, "--config", badConfig}, false, "Error loading config file"},
+	}
+	for _, c := range cases {
+		args := append([]string{"--check", "--host", "127.0.0.1", "--port", "0"}, c.args...)
+		out, err := runMain(t, args...)
+		if (err == nil) != c.ok {
+			t.Errorf("%s: --check exited with %v, want success %v:\n%s", c.name, err, c.ok, out)
+		}
+		if !strings.Contains(out, c.want) {
+			t.Errorf("%s: --check output lacks %q:\n%s", c.name, c.want, out)
+		}
+		if strings.Contains(out, "listening on") {
+			t.Errorf("%s: --check started the server:\n%s", c.name, out)
+		}
+	}
+}
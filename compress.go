@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gorilla/mux"
+)
+
+type flushWriter interface {
+	io.WriteCloser
+	Flush() error
+}
+
+type compressResponseWriter struct {
+	http.ResponseWriter
+	encoding    string
+	minSize     int64
+	head        bool
+	cw          flushWriter
+	wroteHeader bool
+	in, out     int64
+}
+
+type countingWriter struct {
+	w io.Writer
+	n *int64
+}
+
+func (c countingWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	*c.n += int64(n)
+	return n, err
+}
+
+func (w *compressResponseWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+
+	h := w.Header()
+	if code == http.StatusOK && h.Get("Content-Encoding") == "" && h.Get("Content-Range") == "" && isCompressible(h.Get("Content-Type")) && !w.tooSmall() {
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", w.encoding)
+		if etag := h.Get("ETag"); strings.HasPrefix(etag, `"`) {
+			h.Set("ETag", "W/"+etag)
+		}
+		// A HEAD response describes the GET one but has no body to encode.
+		if w.head {
+			w.ResponseWriter.WriteHeader(code)
+			return
+		}
+		out := countingWriter{w: w.ResponseWriter, n: &w.out}
+		if w.encoding == "br" {
+			w.cw = brotli.NewWriter(out)
+		} else {
+			w.cw = gzip.NewWriter(out)
+		}
+	}
+
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *compressResponseWriter) tooSmall() bool {
+	length, err := strconv.ParseInt(w.Header().Get("Content-Length"), 10, 64)
+	return err == nil && length < w.minSize
+}
+
+func (w *compressResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.cw != nil {
+		n, err := w.cw.Write(b)
+		w.in += int64(n)
+		return n, err
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *compressResponseWriter) Flush() {
+	if w.cw != nil {
+		w.cw.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *compressResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok || w.cw != nil {
+		return nil, nil, http.ErrNotSupported
+	}
+	return h.Hijack()
+}
+
+func (w *compressResponseWriter) Close() error {
+	if w.cw == nil {
+		return nil
+	}
+	err := w.cw.Close()
+	recordCompression(w.in, w.out)
+	return err
+}
+
+func validCompressionMode(mode string) error {
+	switch mode {
+	case "auto", "gzip", "br", "none":
+		return nil
+	}
+	return fmt.Errorf("unknown compression mode %q (expected auto, gzip, br or none)", mode)
+}
+
+// defaultNoCompressExts are files whose contents are already compressed,
+// so compressing them again only costs CPU. Some, like .svgz, would
+// otherwise be picked by their compressible Content-Type.
+const defaultNoCompressExts = "gz,br,zst,xz,bz2,zip,7z,rar,svgz,png,jpg,jpeg,gif,webp,avif,woff,woff2,mp3,mp4,webm,ogg"
+
+func compressionMiddleware(mode string, minSize int64, skipExts map[string]bool) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			addVary(w.Header(), "Accept-Encoding")
+
+			encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"), mode)
+			if encoding == "" || hasBlockedExt(skipExts, r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressResponseWriter{ResponseWriter: w, encoding: encoding, minSize: minSize, head: r.Method == http.MethodHead}
+			defer cw.Close()
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+func negotiateEncoding(acceptEncoding, mode string) string {
+	switch mode {
+	case "auto":
+		br, gzip := encodingQuality(acceptEncoding, "br"), encodingQuality(acceptEncoding, "gzip")
+		if br > 0 && br >= gzip {
+			return "br"
+		}
+		if gzip > 0 {
+			return "gzip"
+		}
+	case "gzip", "br":
+		if acceptsEncoding(acceptEncoding, mode) {
+			return mode
+		}
+	}
+	return ""
+}
+
+func acceptsEncoding(acceptEncoding, encoding string) bool {
+	return encodingQuality(acceptEncoding, encoding) > 0
+}
+
+// encodingQuality returns the q-value the Accept-Encoding header gives to
+// encoding, falling back to the "*" entry and then to 0 when neither is
+// listed. A q of 0 means the client refuses the encoding.
+func encodingQuality(acceptEncoding, encoding string) float64 {
+	wildcard := -1.0
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.TrimSpace(name)
+		q := parseQuality(params)
+
+		switch {
+		case strings.EqualFold(name, encoding):
+			return q
+		case name == "*":
+			wildcard = q
+		}
+	}
+	if wildcard < 0 {
+		return 0
+	}
+	return wildcard
+}
+
+func parseQuality(params string) float64 {
+	for _, param := range strings.Split(params, ";") {
+		key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+		if !ok || !strings.EqualFold(strings.TrimSpace(key), "q") {
+			continue
+		}
+		q, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || q < 0 || q > 1 {
+			return 0
+		}
+		return q
+	}
+	return 1
+}
+
+func addVary(h http.Header, value string) {
+	for _, v := range h.Values("Vary") {
+		for _, field := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(field), value) {
+				return
+			}
+		}
+	}
+	h.Add("Vary", value)
+}
+
+func isCompressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	if strings.HasPrefix(mediaType, "text/") {
+		return true
+	}
+
+	switch mediaType {
+	case "application/javascript", "application/json", "application/xml", "image/svg+xml":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompressionHeadMatchesGet(t *testing.T) {
+	dir, cfg := newTestConfig(t)
+	writeTestFile(t, filepath.Join(dir, "app.js"), strings.Repeat("console.log(1);\n", 200))
+	r := newRouter(cfg)
+
+	for _, acceptEncoding := range []string{"gzip", "br", ""} {
+		get := httptest.NewRequest(http.MethodGet, "/static/app.js", nil)
+		head := httptest.NewRequest(http.MethodHead, "/static/app.js", nil)
+		for _, req := range []*http.Request{get, head} {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		getRec, headRec := serveRequest(r, get), serveRequest(r, head)
+
+		for _, name := range []string{"Content-Encoding", "Content-Length", "ETag", "Vary", "Content-Type"} {
+			if g, h := getRec.Header().Get(name), headRec.Header().Get(name); g != h {
+				t.Errorf("Accept-Encoding %q: %s is %q for GET but %q for HEAD", acceptEncoding, name, g, h)
+			}
+		}
+		if headRec.Code != getRec.Code {
+			t.Errorf("Accept-Encoding %q: HEAD = %d, GET = %d", acceptEncoding, headRec.Code, getRec.Code)
+		}
+		if headRec.Body.Len() != 0 {
+			t.Errorf("Accept-Encoding %q: HEAD sent a %d byte body", acceptEncoding, headRec.Body.Len())
+		}
+		if acceptEncoding != "" && headRec.Header().Get("Content-Encoding") != acceptEncoding {
+			t.Errorf("Accept-Encoding %q: HEAD Content-Encoding = %q", acceptEncoding, headRec.Header().Get("Content-Encoding"))
+		}
+	}
+}
+
+func TestGzipCompression(t *testing.T) {
+	dir, cfg := newTestConfig(t)
+	css := strings.Repeat("body { margin: 0; }\n", 200)
+	writeTestFile(t, filepath.Join(dir, "site.css"), css)
+	writeTestFile(t, filepath.Join(dir, "small.css"), "p{}")
+	writeTestFile(t, filepath.Join(dir, "photo.png"), "\x89PNG\r\n\x1a\n"+strings.Repeat("x", 2048))
+	r := newRouter(cfg)
+
+	cases := []struct {
+		path           string
+		acceptEncoding string
+		wantGzip       bool
+	}{
+		{"/static/site.css", "gzip", true},
+		{"/static/site.css", "", false},
+		{"/static/small.css", "gzip", false},
+		{"/static/photo.png", "gzip", false},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodGet, c.path, nil)
+		req.Header.Set("Accept-Encoding", c.acceptEncoding)
+		rec := serveRequest(r, req)
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s (Accept-Encoding %q) = %d, want 200", c.path, c.acceptEncoding, rec.Code)
+			continue
+		}
+		if got := rec.Header().Get("Content-Encoding") == "gzip"; got != c.wantGzip {
+			t.Errorf("%s (Accept-Encoding %q): gzipped %v, want %v", c.path, c.acceptEncoding, got, c.wantGzip)
+			continue
+		}
+		if !c.wantGzip {
+			continue
+		}
+		zr, err := gzip.NewReader(rec.Body)
+		if err != nil {
+			t.Fatalf("%s: %v", c.path, err)
+		}
+		body, err := io.ReadAll(zr)
+		if err != nil || string(body) != css {
+			t.Errorf("%s decompressed to %d bytes (err %v), want the original %d", c.path, len(body), err, len(css))
+		}
+		if ctype := rec.Header().Get("Content-Type"); !strings.HasPrefix(ctype, "text/css") {
+			t.Errorf("%s Content-Type = %q, want text/css", c.path, ctype)
+		}
+	}
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	cases := []struct {
+		acceptEncoding, mode, want string
+	}{
+		{"gzip, br", "auto", "br"},
+		{"gzip", "auto", "gzip"},
+		{"br", "auto", "br"},
+		{"gzip;q=1, br;q=0.5", "auto", "gzip"},
+		{"gzip;q=0.5, br;q=0.5", "auto", "br"},
+		{"br;q=0, gzip", "auto", "gzip"},
+		{"*", "auto", "br"},
+		{"*;q=0.3, gzip", "auto", "gzip"},
+		{"identity", "auto", ""},
+		{"", "auto", ""},
+		{"gzip, br", "gzip", "gzip"},
+		{"br", "gzip", ""},
+		{"gzip, br", "br", "br"},
+		{"gzip", "br", ""},
+		{"gzip, br", "none", ""},
+	}
+	for _, c := range cases {
+		if got := negotiateEncoding(c.acceptEncoding, c.mode); got != c.want {
+			t.Errorf("negotiateEncoding(%q, %s) = %q, want %q", c.acceptEncoding, c.mode, got, c.want)
+		}
+	}
+}
+
+func TestCompressionModes(t *testing.T) {
+	dir, cfg := newTestConfig(t)
+	writeTestFile(t, filepath.Join(dir, "app.js"), strings.Repeat("console.log(1);\n", 200))
+
+	cases := []struct {
+		mode, acceptEncoding, want string
+	}{
+		{"auto", "gzip, br", "br"},
+		{"auto", "gzip", "gzip"},
+		{"auto", "deflate", ""},
+		{"gzip", "gzip, br", "gzip"},
+		{"br", "gzip, br", "br"},
+		{"br", "gzip", ""},
+		{"none", "gzip, br", ""},
+	}
+	for _, c := range cases {
+		cfg.compression = c.mode
+		req := httptest.NewRequest(http.MethodGet, "/static/app.js", nil)
+		req.Header.Set("Accept-Encoding", c.acceptEncoding)
+		rec := serveRequest(newRouter(cfg), req)
+		if got := rec.Header().Get("Content-Encoding"); got != c.want {
+			t.Errorf("--compression %s, Accept-Encoding %q: Content-Encoding = %q, want %q", c.mode, c.acceptEncoding, got, c.want)
+		}
+	}
+}
+
+func TestPrecompressedVariants(t *testing.T) {
+	dir, cfg := newTestConfig(t)
+	writeTestFile(t, filepath.Join(dir, "both.css"), "plain both")
+	writeTestFile(t, filepath.Join(dir, "both.css.gz"), "gzip both")
+	writeTestFile(t, filepath.Join(dir, "both.css.br"), "br both")
+	writeTestFile(t, filepath.Join(dir, "gz.css"), "plain gz")
+	writeTestFile(t, filepath.Join(dir, "gz.css.gz"), "gzip gz")
+	writeTestFile(t, filepath.Join(dir, "none.css"), "plain none")
+	r := newRouter(cfg)
+
+	cases := []struct {
+		path, acceptEncoding string
+		wantEncoding         string
+		wantBody             string
+	}{
+		{"/static/both.css", "gzip, br", "br", "br both"},
+		{"/static/both.css", "gzip", "gzip", "gzip both"},
+		{"/static/both.css", "", "", "plain both"},
+		{"/static/gz.css", "br", "", "plain gz"},
+		{"/static/gz.css", "gzip, br", "gzip", "gzip gz"},
+		{"/static/none.css", "gzip, br", "", "plain none"},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodGet, c.path, nil)
+		req.Header.Set("Accept-Encoding", c.acceptEncoding)
+		rec := serveRequest(r, req)
+		name := c.path + " (Accept-Encoding " + c.acceptEncoding + ")"
+
+		if got := rec.Header().Get("Content-Encoding"); got != c.wantEncoding {
+			t.Errorf("%s: Content-Encoding = %q, want %q", name, got, c.wantEncoding)
+		}
+		// Small enough that the middleware leaves even the plain file alone.
+		if rec.Body.String() != c.wantBody {
+			t.Errorf("%s: body = %q, want %q", name, rec.Body.String(), c.wantBody)
+		}
+		if ctype := rec.Header().Get("Content-Type"); !strings.HasPrefix(ctype, "text/css") {
+			t.Errorf("%s: Content-Type = %q, want the original file's text/css", name, ctype)
+		}
+		if vary := rec.Header().Values("Vary"); len(vary) == 0 || !strings.Contains(strings.Join(vary, ","), "Accept-Encoding") {
+			t.Errorf("%s: Vary = %q, want Accept-Encoding", name, vary)
+		}
+	}
+}
+
+func TestTooSmall(t *testing.T) {
+	cases := []struct {
+		contentLength string
+		want          bool
+	}{
+		{"100", true},
+		{"1023", true},
+		{"1024", false},
+		{"", false},
+		{"junk", false},
+	}
+	for _, c := range cases {
+		w := &compressResponseWriter{ResponseWriter: httptest.NewRecorder(), minSize: 1024}
+		if c.contentLength != "" {
+			w.Header().Set("Content-Length", c.contentLength)
+		}
+		if got := w.tooSmall(); got != c.want {
+			t.Errorf("tooSmall with Content-Length %q = %v, want %v", c.contentLength, got, c.want)
+		}
+	}
+}
+
+func TestCompressMinSize(t *testing.T) {
+	dir, cfg := newTestConfig(t)
+	writeTestFile(t, filepath.Join(dir, "small.js"), strings.Repeat("x", 1023))
+	writeTestFile(t, filepath.Join(dir, "large.js"), strings.Repeat("x", 1024))
+
+	for _, c := range []struct {
+		minSize  int64
+		path     string
+		wantGzip bool
+	}{
+		{1024, "/static/small.js", false},
+		{1024, "/static/large.js", true},
+		{0, "/static/small.js", true},
+		{4096, "/static/large.js", false},
+	} {
+		cfg.compressMinSize = c.minSize
+		req := httptest.NewRequest(http.MethodGet, c.path, nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		rec := serveRequest(newRouter(cfg), req)
+		if got := rec.Header().Get("Content-Encoding") == "gzip"; got != c.wantGzip {
+			t.Errorf("--compress-min-size %d: %s gzipped %v, want %v", c.minSize, c.path, got, c.wantGzip)
+		}
+	}
+}
+
+func TestEncodingQuality(t *testing.T) {
+	cases := []struct {
+		acceptEncoding string
+		want           float64
+	}{
+		{"gzip", 1},
+		{"GZIP;q=0.8", 0.8},
+		{"br, gzip ; q=0.25", 0.25},
+		{"gzip;q=0", 0},
+		{"gzip;q=2", 0},
+		{"gzip;q=high", 0},
+		{"*;q=0.4", 0.4},
+		{"gzip;q=0.6, *;q=0.1", 0.6},
+		{"br", 0},
+		{"", 0},
+	}
+	for _, c := range cases {
+		if got := encodingQuality(c.acceptEncoding, "gzip"); got != c.want {
+			t.Errorf("encodingQuality(%q, gzip) = %v, want %v", c.acceptEncoding, got, c.want)
+		}
+	}
+}
+
+func TestCompressionOptOut(t *testing.T) {
+	dir, cfg := newTestConfig(t)
+	js := strings.Repeat("console.log(1);\n", 200)
+	writeTestFile(t, filepath.Join(dir, "app.js"), js)
+	r := newRouter(cfg)
+
+	for _, acceptEncoding := range []string{"gzip;q=0", "*;q=0", "identity", "br;q=0, gzip;q=0", "gzip;q=0, identity"} {
+		req := httptest.NewRequest(http.MethodGet, "/static/app.js", nil)
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+		rec := serveRequest(r, req)
+		if enc := rec.Header().Get("Content-Encoding"); enc != "" || rec.Body.String() != js {
+			t.Errorf("Accept-Encoding %q: Content-Encoding %q, %d bytes; want the file uncompressed", acceptEncoding, enc, rec.Body.Len())
+		}
+	}
+}
+
+func TestNoCompressExtensions(t *testing.T) {
+	png := "\x89PNG\r\n\x1a\n" + strings.Repeat("\x00", 4096)
+	text := strings.Repeat("plain text\n", 400)
+	for _, c := range []struct {
+		spec       string
+		file, body string
+		compressed bool
+	}{
+		{defaultNoCompressExts, "logo.png", png, false},
+		{defaultNoCompressExts, "LOGO.PNG", png, false},
+		{defaultNoCompressExts, "notes.txt", text, true},
+		{"txt, .md", "notes.txt", text, false},
+		{"txt, .md", "README.md", text, false},
+		{"txt", "notes.csv", text, true},
+	} {
+		dir, cfg := newTestConfig(t)
+		writeTestFile(t, filepath.Join(dir, c.file), c.body)
+		cfg.noCompressExts = parseExtensions(c.spec)
+		r := newRouter(cfg)
+
+		req := httptest.NewRequest(http.MethodGet, "/static/"+c.file, nil)
+		req.Header.Set("Accept-Encoding", "gzip, br")
+		rec := serveRequest(r, req)
+		enc := rec.Header().Get("Content-Encoding")
+		if rec.Code != http.StatusOK || (enc != "") != c.compressed {
+			t.Errorf("--no-compress-ext %q: GET %s = %d with Content-Encoding %q, want compressed %v", c.spec, c.file, rec.Code, enc, c.compressed)
+		}
+		if !c.compressed && rec.Body.String() != c.body {
+			t.Errorf("--no-compress-ext %q: GET %s sent %d bytes, want the file as is", c.spec, c.file, rec.Body.Len())
+		}
+	}
+}
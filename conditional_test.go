@@ -0,0 +1,139 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIfModifiedSince(t *testing.T) {
+	dir, h := newTestSite(t)
+	modTime := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	for _, name := range []string{"a.txt", "index.html"} {
+		if err := os.Chtimes(filepath.Join(dir, name), modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		since time.Time
+		want  int
+	}{
+		{modTime, http.StatusNotModified},
+		{modTime.Add(time.Hour), http.StatusNotModified},
+		{modTime.Add(-time.Hour), http.StatusOK},
+	}
+	// "/" stats the directory's index file itself rather than the file
+	// the request named; buffering swaps the file for an in-memory copy.
+	for _, bufferSize := range []int64{0, 1 << 20} {
+		h.bufferSize = bufferSize
+		for _, path := range []string{"/a.txt", "/"} {
+			for _, c := range cases {
+				header := http.Header{"If-Modified-Since": {c.since.Format(http.TimeFormat)}}
+				rec := serveRaw(h, path, header)
+				if rec.Code != c.want {
+					t.Errorf("buffer=%d GET %s If-Modified-Since %s = %d, want %d", bufferSize, path, c.since, rec.Code, c.want)
+				}
+				if c.want == http.StatusNotModified && rec.Body.Len() != 0 {
+					t.Errorf("buffer=%d GET %s: 304 with a %d byte body", bufferSize, path, rec.Body.Len())
+				}
+			}
+		}
+	}
+}
+
+func TestIfModifiedSinceIgnoredWithIfNoneMatch(t *testing.T) {
+	_, h := newTestSite(t)
+	header := http.Header{
+		"If-None-Match":     {`"not-the-etag"`},
+		"If-Modified-Since": {time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)},
+	}
+	if rec := serveRaw(h, "/a.txt", header); rec.Code != http.StatusOK {
+		t.Errorf("GET /a.txt with a stale If-None-Match = %d, want 200", rec.Code)
+	}
+}
+
+func TestIfNoneMatch(t *testing.T) {
+	for _, mode := range []string{"mtime", "hash"} {
+		_, h := newTestSite(t)
+		h.etagMode = mode
+		rec := serveRaw(h, "/a.txt", nil)
+		etag := rec.Header().Get("ETag")
+		if rec.Code != http.StatusOK || !strings.HasPrefix(etag, `"`) {
+			t.Errorf("--etag-mode %s: GET /a.txt = %d with ETag %q, want 200 and a strong ETag", mode, rec.Code, etag)
+			continue
+		}
+
+		// A restarted server has an empty hash cache but the same files.
+		restarted := *h
+		restarted.hashes = newIntegrityCache()
+		if again := serveRaw(&restarted, "/a.txt", nil).Header().Get("ETag"); again != etag {
+			t.Errorf("--etag-mode %s: ETag changed from %q to %q across a restart", mode, etag, again)
+		}
+
+		rec = serveRaw(h, "/a.txt", http.Header{"If-None-Match": {etag}})
+		if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+			t.Errorf("--etag-mode %s: If-None-Match %s = %d with a %d byte body, want an empty 304", mode, etag, rec.Code, rec.Body.Len())
+		}
+	}
+
+	_, h := newTestSite(t)
+	h.etagMode = "off"
+	if etag := serveRaw(h, "/a.txt", nil).Header().Get("ETag"); etag != "" {
+		t.Errorf("--etag-mode off: ETag = %q, want none", etag)
+	}
+}
+
+func TestETagModes(t *testing.T) {
+	sum := sha256.Sum256([]byte("hello"))
+	for _, c := range []struct {
+		mode string
+		want *regexp.Regexp
+	}{
+		{"mtime", regexp.MustCompile(`^"[0-9a-f]+-5"$`)},
+		{"hash", regexp.MustCompile(`^"` + regexp.QuoteMeta("sha256-"+base64.StdEncoding.EncodeToString(sum[:])) + `"$`)},
+	} {
+		_, h := newTestSite(t)
+		h.etagMode = c.mode
+		if etag := serveRaw(h, "/a.txt", nil).Header().Get("ETag"); !c.want.MatchString(etag) {
+			t.Errorf("--etag-mode %s: ETag = %q, want it to match %s", c.mode, etag, c.want)
+		}
+	}
+}
+
+func TestHashETagFollowsContent(t *testing.T) {
+	for _, c := range []struct {
+		mode string
+		// touched is the status for the old ETag once the file is
+		// rewritten with the same content and a new mtime.
+		touched int
+	}{
+		{"mtime", http.StatusOK},
+		{"hash", http.StatusNotModified},
+	} {
+		dir, h := newTestSite(t)
+		h.etagMode = c.mode
+		path := filepath.Join(dir, "a.txt")
+		etag := serveRaw(h, "/a.txt", nil).Header().Get("ETag")
+		conditional := http.Header{"If-None-Match": {etag}}
+
+		later := time.Now().Add(time.Minute)
+		os.Chtimes(path, later, later)
+		if rec := serveRaw(h, "/a.txt", conditional); rec.Code != c.touched {
+			t.Errorf("--etag-mode %s: old ETag after a touch = %d, want %d", c.mode, rec.Code, c.touched)
+		}
+
+		writeTestFile(t, path, "hullo")
+		later = later.Add(time.Minute)
+		os.Chtimes(path, later, later)
+		if rec := serveRaw(h, "/a.txt", conditional); rec.Code != http.StatusOK || rec.Body.String() != "hullo" {
+			t.Errorf("--etag-mode %s: old ETag after a content change = %d %q, want 200 with the new content", c.mode, rec.Code, rec.Body.String())
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+)
+
+func loadConfigFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	// Numbers are kept as written, so 1048576 reaches flag.Set as
+	// "1048576" rather than "1.048576e+06".
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var values map[string]interface{}
+	if err := dec.Decode(&values); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	if dec.More() {
+		return fmt.Errorf("%s: unexpected data after the settings object", path)
+	}
+
+	explicit := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	for name, value := range values {
+		if name == "config" || name == "help" || flag.Lookup(name) == nil {
+			return fmt.Errorf("%s: unknown setting %q", path, name)
+		}
+		if explicit[name] {
+			continue
+		}
+
+		items, ok := value.([]interface{})
+		if !ok {
+			items = []interface{}{value}
+		}
+		for _, item := range items {
+			if err := flag.Set(name, fmt.Sprint(item)); err != nil {
+				return fmt.Errorf("%s: invalid value for %q: %v", path, name, err)
+			}
+		}
+	}
+	return nil
+}
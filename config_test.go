@@ -0,0 +1,31 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var (
+	testConfigSize = flag.Int64("test-config-size", 0, "")
+	testConfigRate = flag.Float64("test-config-rate", 0, "")
+)
+
+func TestLoadConfigFileKeepsNumbers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "static.json")
+	config := `{"test-config-size": 1048576, "test-config-rate": 0.25}`
+	if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := loadConfigFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if *testConfigSize != 1048576 {
+		t.Errorf("test-config-size = %d, want 1048576", *testConfigSize)
+	}
+	if *testConfigRate != 0.25 {
+		t.Errorf("test-config-rate = %v, want 0.25", *testConfigRate)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCORSOptions(t *testing.T) {
+	_, cfg := newTestConfig(t)
+	cfg.corsOrigins = parseOrigins("https://app.example")
+	r := newRouter(cfg)
+
+	cases := []struct {
+		name, origin, requestMethod string
+		allowOrigin                 string
+	}{
+		{"allowed preflight", "https://app.example", "GET", "https://app.example"},
+		{"disallowed origin", "https://evil.example", "GET", ""},
+		{"allowed origin, not a preflight", "https://app.example", "", "https://app.example"},
+		{"no origin", "", "", ""},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodOptions, "/static/a.txt", nil)
+		if c.origin != "" {
+			req.Header.Set("Origin", c.origin)
+		}
+		if c.requestMethod != "" {
+			req.Header.Set("Access-Control-Request-Method", c.requestMethod)
+		}
+		rec := serveRequest(r, req)
+
+		if rec.Code != http.StatusNoContent {
+			t.Errorf("%s: OPTIONS = %d, want 204", c.name, rec.Code)
+		}
+		if rec.Body.Len() != 0 {
+			t.Errorf("%s: OPTIONS sent a %d byte body", c.name, rec.Body.Len())
+		}
+		if got := rec.Header().Get("Access-Control-Allow-Origin"); got != c.allowOrigin {
+			t.Errorf("%s: Access-Control-Allow-Origin = %q, want %q", c.name, got, c.allowOrigin)
+		}
+		preflight := c.allowOrigin != "" && c.requestMethod != ""
+		if got := rec.Header().Get("Access-Control-Allow-Methods"); (got != "") != preflight {
+			t.Errorf("%s: Access-Control-Allow-Methods = %q", c.name, got)
+		}
+		if !preflight && rec.Header().Get("Allow") != "GET, HEAD, OPTIONS" {
+			t.Errorf("%s: Allow = %q, want %q", c.name, rec.Header().Get("Allow"), "GET, HEAD, OPTIONS")
+		}
+	}
+}
+
+func TestOptionsWithoutCORS(t *testing.T) {
+	_, cfg := newTestConfig(t)
+	r := newRouter(cfg)
+
+	rec := serveRequest(r, httptest.NewRequest(http.MethodOptions, "/static/a.txt", nil))
+	if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != "GET, HEAD" {
+		t.Errorf("OPTIONS without --cors-origins = %d, Allow %q; want 405, \"GET, HEAD\"", rec.Code, rec.Header().Get("Allow"))
+	}
+}
+
+func TestCORSSimpleRequest(t *testing.T) {
+	_, cfg := newTestConfig(t)
+	cases := []struct {
+		name, origins, origin string
+		allowOrigin           string
+	}{
+		{"allowed origin", "https://app.example, https://admin.example/", "https://admin.example", "https://admin.example"},
+		{"disallowed origin", "https://app.example", "https://evil.example", ""},
+		{"no origin", "https://app.example", "", ""},
+		{"wildcard", "*", "https://anyone.example", "*"},
+	}
+	for _, c := range cases {
+		cfg.corsOrigins = parseOrigins(c.origins)
+		req := httptest.NewRequest(http.MethodGet, "/static/a.txt", nil)
+		if c.origin != "" {
+			req.Header.Set("Origin", c.origin)
+		}
+		rec := serveRequest(newRouter(cfg), req)
+
+		if rec.Code != http.StatusOK || rec.Body.String() != "hello" {
+			t.Errorf("%s: GET = %d %q, want the file either way", c.name, rec.Code, rec.Body.String())
+		}
+		if got := rec.Header().Get("Access-Control-Allow-Origin"); got != c.allowOrigin {
+			t.Errorf("%s: Access-Control-Allow-Origin = %q, want %q", c.name, got, c.allowOrigin)
+		}
+		if !strings.Contains(strings.Join(rec.Header().Values("Vary"), ","), "Origin") {
+			t.Errorf("%s: Vary = %q, want Origin listed", c.name, rec.Header().Values("Vary"))
+		}
+	}
+}
+
+func TestCORSPreflightHeaders(t *testing.T) {
+	_, cfg := newTestConfig(t)
+	cfg.corsOrigins = parseOrigins("https://app.example")
+	req := httptest.NewRequest(http.MethodOptions, "/static/a.txt", nil)
+	req.Header.Set("Origin", "https://app.example")
+	req.Header.Set("Access-Control-Request-Method", "GET")
+	req.Header.Set("Access-Control-Request-Headers", "X-Requested-With")
+	rec := serveRequest(newRouter(cfg), req)
+
+	for name, want := range map[string]string{
+		"Access-Control-Allow-Methods": "GET, HEAD, OPTIONS",
+		"Access-Control-Allow-Headers": "X-Requested-With",
+		"Access-Control-Max-Age":       "86400",
+	} {
+		if got := rec.Header().Get(name); got != want {
+			t.Errorf("preflight %s = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+type secondBucket struct {
+	second int64
+	count  int
+}
+
+// requestCounter counts requests in one-second buckets over a fixed window,
+// so memory stays constant no matter how many requests arrive.
+type requestCounter struct {
+	sync.Mutex
+	buckets []secondBucket
+}
+
+func newRequestCounter(window time.Duration) *requestCounter {
+	return &requestCounter{buckets: make([]secondBucket, windowSeconds(window))}
+}
+
+func windowSeconds(window time.Duration) int {
+	n := int(window / time.Second)
+	if window%time.Second != 0 {
+		n++
+	}
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+func (c *requestCounter) record(t time.Time) {
+	second := t.Unix()
+
+	c.Lock()
+	defer c.Unlock()
+	b := &c.buckets[second%int64(len(c.buckets))]
+	if b.second != second {
+		b.second = second
+		b.count = 0
+	}
+	b.count++
+}
+
+func (c *requestCounter) count(now time.Time) int {
+	second := now.Unix()
+	oldest := second - int64(len(c.buckets))
+
+	c.Lock()
+	defer c.Unlock()
+	total := 0
+	for _, b := range c.buckets {
+		if b.second > oldest && b.second <= second {
+			total += b.count
+		}
+	}
+	return total
+}
+
+// series returns the per-second counts for the window, oldest first.
+func (c *requestCounter) series(now time.Time) []int {
+	second := now.Unix()
+	n := int64(len(c.buckets))
+
+	c.Lock()
+	defer c.Unlock()
+	counts := make([]int, n)
+	for i := int64(0); i < n; i++ {
+		s := second - n + 1 + i
+		if b := c.buckets[s%n]; b.second == s {
+			counts[i] = b.count
+		}
+	}
+	return counts
+}
+
+func (c *requestCounter) reset() {
+	c.Lock()
+	defer c.Unlock()
+	for i := range c.buckets {
+		c.buckets[i] = secondBucket{}
+	}
+}
+
+type pathBucket struct {
+	second int64
+	counts map[string]int
+}
+
+type pathHits struct {
+	Path string
+	Hits int
+}
+
+// pathCounter tracks hits per path in one-second buckets over a fixed window.
+type pathCounter struct {
+	sync.Mutex
+	buckets []pathBucket
+}
+
+func newPathCounter(window time.Duration) *pathCounter {
+	return &pathCounter{buckets: make([]pathBucket, windowSeconds(window))}
+}
+
+func (c *pathCounter) record(t time.Time, path string) {
+	second := t.Unix()
+
+	c.Lock()
+	defer c.Unlock()
+	b := &c.buckets[second%int64(len(c.buckets))]
+	if b.second != second || b.counts == nil {
+		b.second = second
+		b.counts = map[string]int{}
+	}
+	b.counts[path]++
+}
+
+func (c *pathCounter) reset() {
+	c.Lock()
+	defer c.Unlock()
+	for i := range c.buckets {
+		c.buckets[i] = pathBucket{}
+	}
+}
+
+func (c *pathCounter) top(now time.Time, n int) []pathHits {
+	second := now.Unix()
+	oldest := second - int64(len(c.buckets))
+
+	c.Lock()
+	totals := map[string]int{}
+	for _, b := range c.buckets {
+		if b.second > oldest && b.second <= second {
+			for path, count := range b.counts {
+				totals[path] += count
+			}
+		}
+	}
+	c.Unlock()
+
+	hits := make([]pathHits, 0, len(totals))
+	for path, count := range totals {
+		hits = append(hits, pathHits{Path: path, Hits: count})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Hits != hits[j].Hits {
+			return hits[i].Hits > hits[j].Hits
+		}
+		return hits[i].Path < hits[j].Path
+	})
+	if len(hits) > n {
+		hits = hits[:n]
+	}
+	return hits
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRequestCounterWindow(t *testing.T) {
+	c := newRequestCounter(10 * time.Second)
+	start := time.Unix(1_700_000_000, 0)
+	for i := 0; i < 20; i++ {
+		c.record(start.Add(time.Duration(i) * time.Second))
+		c.record(start.Add(time.Duration(i) * time.Second))
+	}
+
+	now := start.Add(19 * time.Second)
+	if got := c.count(now); got != 20 {
+		t.Errorf("count over the last 10s = %d, want 20", got)
+	}
+	if got := c.count(now.Add(5 * time.Second)); got != 10 {
+		t.Errorf("count 5s later = %d, want 10", got)
+	}
+	if got := c.count(now.Add(time.Minute)); got != 0 {
+		t.Errorf("count a minute later = %d, want 0", got)
+	}
+
+	series := c.series(now)
+	if len(series) != 10 {
+		t.Fatalf("series has %d entries, want 10", len(series))
+	}
+	for i, n := range series {
+		if n != 2 {
+			t.Errorf("series[%d] = %d, want 2", i, n)
+		}
+	}
+}
+
+func TestRequestCounterSeriesBurst(t *testing.T) {
+	c := newRequestCounter(10 * time.Second)
+	start := time.Unix(1_700_000_000, 0)
+	burst := map[time.Duration]int{0: 5, 2 * time.Second: 3, 4500 * time.Millisecond: 7}
+	for offset, n := range burst {
+		for i := 0; i < n; i++ {
+			c.record(start.Add(offset))
+		}
+	}
+
+	now := start.Add(5 * time.Second)
+	series := c.series(now)
+	want := []int{0, 0, 0, 0, 5, 0, 3, 0, 7, 0}
+	sum := 0
+	for i, n := range series {
+		sum += n
+		if n != want[i] {
+			t.Errorf("series[%d] = %d, want %d", i, n, want[i])
+		}
+	}
+	if sum != 15 || c.count(now) != sum {
+		t.Errorf("series sums to %d and count is %d, want both 15", sum, c.count(now))
+	}
+}
+
+func TestRequestCounterSizeIsFixed(t *testing.T) {
+	c := newRequestCounter(60 * time.Second)
+	start := time.Unix(1_700_000_000, 0)
+	for i := 0; i < 100_000; i++ {
+		c.record(start.Add(time.Duration(i) * time.Millisecond))
+	}
+	if len(c.buckets) != 60 {
+		t.Errorf("counter holds %d buckets after 100000 requests, want 60", len(c.buckets))
+	}
+}
+
+// BenchmarkRequestCounterRecord reports allocations per request; it stays
+// at zero because recording reuses the fixed buckets.
+func BenchmarkRequestCounterRecord(b *testing.B) {
+	c := newRequestCounter(60 * time.Second)
+	now := time.Now()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		c.record(now.Add(time.Duration(i) * time.Microsecond))
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+const cpuSampleInterval = time.Second
+
+// cpuPercent holds the latest process CPU utilisation as float64 bits,
+// where 100 is one core fully busy.
+var cpuPercent atomic.Uint64
+
+// sampleCPU measures the process CPU time used over each interval in the
+// background, so /stats can report it without waiting for a sample.
+func sampleCPU(interval time.Duration) {
+	last, ok := processCPUTime()
+	if !ok {
+		return
+	}
+	lastWall := time.Now()
+
+	for range time.Tick(interval) {
+		now, _ := processCPUTime()
+		wall := time.Now()
+		percent := 100 * (now - last).Seconds() / wall.Sub(lastWall).Seconds()
+		cpuPercent.Store(math.Float64bits(percent))
+		last, lastWall = now, wall
+	}
+}
+
+func cpuUsage() float64 {
+	return math.Float64frombits(cpuPercent.Load())
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package main
+
+import "time"
+
+// processCPUTime is not implemented on this platform; /stats reports a CPU
+// usage of 0.
+func processCPUTime() (time.Duration, bool) {
+	return 0, false
+}
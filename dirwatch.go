@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// dirCheckInterval is how often monitorDirectory checks the static
+// directory. It is a variable so tests can shorten it.
+var dirCheckInterval = 5 * time.Second
+
+func validDirLostPolicy(policy string) error {
+	switch policy {
+	case "retry", "exit":
+		return nil
+	}
+	return fmt.Errorf("unknown --on-dir-lost policy %q (expected retry or exit)", policy)
+}
+
+// monitorDirectory checks dir every interval, for when a mounted volume
+// goes away under a running server. With the exit policy the process exits
+// so an orchestrator can restart it; with retry it keeps checking, failing
+// /readyz until the directory is back.
+func monitorDirectory(dir, policy string, interval time.Duration) {
+	lost := false
+	for range time.Tick(interval) {
+		err := checkDirectory(dir)
+		switch {
+		case err != nil && policy == "exit":
+			log.Printf("Error: static directory %s is no longer available, exiting: %v", dir, err)
+			os.Exit(1)
+		case err != nil && !lost:
+			log.Printf("Error: static directory %s is no longer available, retrying every %s: %v", dir, interval, err)
+			ready.Store(false)
+			lost = true
+		case err == nil && lost:
+			log.Printf("Static directory %s is available again", dir)
+			ready.Store(true)
+			lost = false
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+// dirCheckEnv overrides dirCheckInterval in a re-executed server.
+const dirCheckEnv = "STATIC_TEST_DIR_CHECK_INTERVAL"
+
+func startDirWatchServer(t *testing.T, dir string, args ...string) (string, *exec.Cmd, *syncBuffer) {
+	t.Helper()
+	args = append([]string{"--host", "127.0.0.1", "--port", "0", "--directory", dir}, args...)
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), runMainEnv+"=1", dirCheckEnv+"=20ms")
+	addr, logs := startCommand(t, cmd)
+	return addr, cmd, logs
+}
+
+func TestDirectoryLostExit(t *testing.T) {
+	dir := t.TempDir()
+	_, cmd, logs := startDirWatchServer(t, dir, "--on-dir-lost", "exit")
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+	select {
+	case err := <-exited:
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 {
+			t.Errorf("server exited with %v, want status 1", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("server still running after its directory was removed:\n%s", logs)
+	}
+	if !strings.Contains(logs.String(), "is no longer available, exiting") {
+		t.Errorf("server did not log why it exited:\n%s", logs)
+	}
+}
+
+func TestDirectoryLostRetry(t *testing.T) {
+	dir := t.TempDir()
+	addr, _, logs := startDirWatchServer(t, dir)
+
+	waitForReady := func(want int) {
+		t.Helper()
+		deadline := time.Now().Add(10 * time.Second)
+		for {
+			resp, err := http.Get("http://" + addr + "/readyz")
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode == want {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("/readyz = %d, want %d:\n%s", resp.StatusCode, want, logs)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	waitForReady(http.StatusServiceUnavailable)
+	waitForLog(t, logs, "is no longer available, retrying")
+
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	waitForReady(http.StatusOK)
+	waitForLog(t, logs, "is available again")
+}
+
+func TestValidDirLostPolicy(t *testing.T) {
+	for _, c := range []struct {
+		policy string
+		ok     bool
+	}{
+		{"retry", true},
+		{"exit", true},
+		{"", false},
+		{"restart", false},
+	} {
+		if err := validDirLostPolicy(c.policy); (err == nil) != c.ok {
+			t.Errorf("validDirLostPolicy(%q) = %v, want ok %v", c.policy, err, c.ok)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"syscall"
+)
+
+// errorWriter remembers the first error returned while writing the body,
+// which http.ServeContent otherwise discards.
+type errorWriter struct {
+	http.ResponseWriter
+	err error
+}
+
+func (w *errorWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	if err != nil && w.err == nil {
+		w.err = err
+	}
+	return n, err
+}
+
+func (w *errorWriter) ReadFrom(src io.Reader) (int64, error) {
+	n, err := io.Copy(w.ResponseWriter, src)
+	if err != nil && w.err == nil {
+		w.err = err
+	}
+	return n, err
+}
+
+func (w *errorWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func isClientDisconnect(r *http.Request, err error) bool {
+	return errors.Is(r.Context().Err(), context.Canceled) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, syscall.ECONNRESET)
+}
+
+func logWriteError(r *http.Request, err error) {
+	if err == nil {
+		return
+	}
+	if isClientDisconnect(r, err) {
+		if accessLogVerbose {
+			log.Printf("Client disconnected: %s %s from %s", r.Method, r.RequestURI, clientIP(r))
+		}
+		return
+	}
+	log.Printf("Error writing response for %s: %v", r.RequestURI, err)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+type failingWriter struct {
+	http.ResponseWriter
+}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, syscall.EPIPE
+}
+
+func TestErrorWriterReadFrom(t *testing.T) {
+	under := &readerFromRecorder{ResponseRecorder: httptest.NewRecorder()}
+	w := &errorWriter{ResponseWriter: under}
+	if _, err := io.Copy(w, io.LimitReader(strings.NewReader("hello"), 5)); err != nil {
+		t.Fatal(err)
+	}
+	if under.readFroms != 1 || under.Body.String() != "hello" {
+		t.Errorf("underlying ReadFrom called %d times, body %q", under.readFroms, under.Body.String())
+	}
+
+	w = &errorWriter{ResponseWriter: failingWriter{httptest.NewRecorder()}}
+	io.Copy(w, io.LimitReader(strings.NewReader("hello"), 5))
+	if !errors.Is(w.err, syscall.EPIPE) {
+		t.Errorf("errorWriter kept %v, want EPIPE", w.err)
+	}
+}
+
+// syncBuffer is a bytes.Buffer that the server goroutines and the test can
+// share as a log output.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestClientDisconnectMidDownload(t *testing.T) {
+	dir, cfg := newTestConfig(t)
+	writeTestFile(t, filepath.Join(dir, "large.bin"), strings.Repeat("x", 64<<20))
+
+	var logs syncBuffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+	defer func(saved bool) { accessLogVerbose = saved }(accessLogVerbose)
+	accessLogVerbose = true
+
+	done := make(chan struct{})
+	router := newRouter(cfg)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(done)
+		router.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/static/large.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(resp.Body, make([]byte, 64<<10)); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("handler still running 10s after the client went away")
+	}
+	if !strings.Contains(logs.String(), "Client disconnected: GET /static/large.bin") {
+		t.Errorf("no disconnect logged; log was:\n%s", logs.String())
+	}
+	if strings.Contains(logs.String(), "Error writing response") {
+		t.Errorf("disconnect logged as a write error:\n%s", logs.String())
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	maxConcurrentDownloads = 4
+	downloadAttempts       = 3
+	downloadRetryDelay     = 500 * time.Millisecond
+)
+
+// assetDownload is a file fetched into the static directory at startup
+// when it is missing there, such as the favicon from --favicon-url.
+type assetDownload struct {
+	name    string
+	url     string
+	dest    string
+	maxSize int64
+}
+
+// permanentError marks download errors that retrying will not fix.
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// downloadAssets fetches the missing assets concurrently, all within one
+// timeout, so a slow host delays startup by at most that long. Failures
+// are logged and otherwise ignored: every asset has a built-in fallback.
+func downloadAssets(assets []assetDownload, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	slots := make(chan struct{}, maxConcurrentDownloads)
+	var wg sync.WaitGroup
+	for _, asset := range assets {
+		if _, err := os.Stat(asset.dest); !errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+
+		wg.Add(1)
+		go func(asset assetDownload) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			if err := downloadWithRetry(ctx, asset); err != nil {
+				log.Printf("Error downloading %s, using the built-in one: %v", asset.name, err)
+			}
+		}(asset)
+	}
+	wg.Wait()
+}
+
+func downloadWithRetry(ctx context.Context, asset assetDownload) error {
+	var err error
+	for attempt := 1; attempt <= downloadAttempts; attempt++ {
+		if err = downloadAsset(ctx, asset); err == nil || errors.As(err, new(permanentError)) {
+			return err
+		}
+		if attempt == downloadAttempts {
+			break
+		}
+
+		timer := time.NewTimer(downloadRetryDelay * time.Duration(attempt))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+	}
+	return err
+}
+
+func downloadAsset(ctx context.Context, asset assetDownload) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, asset.url, nil)
+	if err != nil {
+		return permanentError{err}
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("unexpected status %s", resp.Status)
+		if resp.StatusCode < http.StatusInternalServerError && resp.StatusCode != http.StatusTooManyRequests {
+			err = permanentError{err}
+		}
+		return err
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, asset.maxSize+1))
+	if err != nil {
+		return err
+	}
+	if int64(len(data)) > asset.maxSize {
+		return permanentError{fmt.Errorf("%s is larger than %d bytes", asset.name, asset.maxSize)}
+	}
+
+	// Written under a temporary name so a request racing the download
+	// never sees a partial file.
+	tmp, err := os.CreateTemp(filepath.Dir(asset.dest), ".download-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), asset.dest)
+}
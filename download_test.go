@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFaviconDownloadFailureIsNotFatal(t *testing.T) {
+	origin := httptest.NewServer(http.NotFoundHandler())
+	defer origin.Close()
+	dir := t.TempDir()
+	addr, _, logs := startServer(t, "--directory", dir, "--favicon-url", origin.URL+"/favicon.ico")
+
+	if !strings.Contains(logs.String(), "Error downloading favicon") {
+		t.Errorf("failed download not logged:\n%s", logs)
+	}
+	resp, err := http.Get("http://" + addr + "/favicon.ico")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || !bytes.Equal(body, defaultFavicon) {
+		t.Errorf("GET /favicon.ico after a failed download = %d, %d bytes; want the built-in favicon", resp.StatusCode, len(body))
+	}
+}
+
+func TestDownloadAssetsTimeout(t *testing.T) {
+	release := make(chan struct{})
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer origin.Close()
+	defer close(release)
+
+	var logs syncBuffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	dest := filepath.Join(t.TempDir(), "favicon.ico")
+	start := time.Now()
+	downloadAssets([]assetDownload{{name: "favicon", url: origin.URL, dest: dest, maxSize: maxFaviconSize}}, 100*time.Millisecond)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("downloadAssets took %s against a hung origin, want about the 100ms timeout", elapsed)
+	}
+	if _, err := os.Stat(dest); !os.IsNotExist(err) {
+		t.Errorf("a timed out download left %s behind (err %v)", dest, err)
+	}
+	if !strings.Contains(logs.String(), "Error downloading favicon") {
+		t.Errorf("timed out download not logged: %q", logs.String())
+	}
+}
+
+func TestDownloadAssetsSuccess(t *testing.T) {
+	icon := []byte("\x00\x00\x01\x00downloaded")
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(icon)
+	}))
+	defer origin.Close()
+
+	dest := filepath.Join(t.TempDir(), "favicon.ico")
+	downloadAssets([]assetDownload{{name: "favicon", url: origin.URL, dest: dest, maxSize: maxFaviconSize}}, 5*time.Second)
+	if got, err := os.ReadFile(dest); err != nil || !bytes.Equal(got, icon) {
+		t.Errorf("downloaded favicon = %q (err %v), want %q", got, err, icon)
+	}
+}
+
+func TestDownloadAssetsConcurrently(t *testing.T) {
+	const latency = 300 * time.Millisecond
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(latency)
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer origin.Close()
+
+	dir := t.TempDir()
+	var assets []assetDownload
+	for i := 0; i < maxConcurrentDownloads; i++ {
+		name := "asset" + strconv.Itoa(i)
+		assets = append(assets, assetDownload{name: name, url: origin.URL + "/" + name, dest: filepath.Join(dir, name), maxSize: 1024})
+	}
+	start := time.Now()
+	downloadAssets(assets, 5*time.Second)
+	if elapsed := time.Since(start); elapsed >= 2*latency {
+		t.Errorf("downloading %d assets with %s latency took %s, want them fetched side by side", len(assets), latency, elapsed)
+	}
+	for _, asset := range assets {
+		if got, err := os.ReadFile(asset.dest); err != nil || string(got) != "/"+asset.name {
+			t.Errorf("%s = %q (err %v), want it downloaded", asset.name, got, err)
+		}
+	}
+}
+
+func TestDownloadAssetsRetries(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		statuses []int
+		fetches  int32
+		ok       bool
+	}{
+		{"recovers after a 503", []int{http.StatusServiceUnavailable, http.StatusOK}, 2, true},
+		{"gives up on a 404", []int{http.StatusNotFound, http.StatusOK}, 1, false},
+		{"gives up after every attempt fails", []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway, http.StatusOK}, downloadAttempts, false},
+	} {
+		var fetches atomic.Int32
+		origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n := fetches.Add(1)
+			w.WriteHeader(c.statuses[n-1])
+			w.Write([]byte("icon"))
+		}))
+
+		var logs syncBuffer
+		log.SetOutput(&logs)
+		dest := filepath.Join(t.TempDir(), "favicon.ico")
+		downloadAssets([]assetDownload{{name: "favicon", url: origin.URL, dest: dest, maxSize: maxFaviconSize}}, 10*time.Second)
+		log.SetOutput(os.Stderr)
+		origin.Close()
+
+		if n := fetches.Load(); n != c.fetches {
+			t.Errorf("%s: fetched %d times, want %d", c.name, n, c.fetches)
+		}
+		_, err := os.Stat(dest)
+		if (err == nil) != c.ok {
+			t.Errorf("%s: favicon saved %v, want %v", c.name, err == nil, c.ok)
+		}
+		if logged := strings.Contains(logs.String(), "Error downloading favicon"); logged == c.ok {
+			t.Errorf("%s: failure logged %v, want %v: %q", c.name, logged, !c.ok, logs.String())
+		}
+	}
+}
+
+func TestDownloadAssetsSkipsExistingFiles(t *testing.T) {
+	var fetches atomic.Int32
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		w.Write([]byte("downloaded"))
+	}))
+	defer origin.Close()
+
+	dest := filepath.Join(t.TempDir(), "favicon.ico")
+	writeTestFile(t, dest, "local")
+	downloadAssets([]assetDownload{{name: "favicon", url: origin.URL, dest: dest, maxSize: maxFaviconSize}}, 5*time.Second)
+	if got, _ := os.ReadFile(dest); string(got) != "local" || fetches.Load() != 0 {
+		t.Errorf("existing favicon = %q after %d fetches, want it left alone", got, fetches.Load())
+	}
+}
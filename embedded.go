@@ -0,0 +1,93 @@
+package main
+
+import (
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// embeddedSite holds the files compiled in with the embedsite build tag;
+// it is nil in regular builds. See embedsite.go.
+var embeddedSite fs.FS
+
+// siteIsEmpty reports whether fsys holds nothing but the .gitkeep that
+// keeps the site directory in git, i.e. nothing was copied in before the
+// embedsite build.
+func siteIsEmpty(fsys fs.FS) bool {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return true
+	}
+	for _, entry := range entries {
+		if entry.Name() != ".gitkeep" {
+			return false
+		}
+	}
+	return true
+}
+
+// embeddedHandler serves files from an fs.FS, such as the embedded site,
+// with the same dotfile, index and caching rules as staticHandler.
+type embeddedHandler struct {
+	fsys        fs.FS
+	indexFile   string
+	cacheRules  map[string]int
+	dotfiles    bool
+	emitExpires bool
+	blockedExts map[string]bool
+}
+
+func (h *embeddedHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !h.dotfiles && hasDotComponent(r.URL.Path) {
+		httpError(w, r, http.StatusNotFound, "File not found")
+		return
+	}
+	if hasBlockedExt(h.blockedExts, r.URL.Path) {
+		httpError(w, r, http.StatusForbidden, "Access denied")
+		return
+	}
+
+	// fs.FS paths are unrooted and may not contain "..", so cleaning the
+	// request path is enough to keep it inside the file system.
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	if name == "" {
+		name = "."
+	}
+
+	stat, err := fs.Stat(h.fsys, name)
+	if err != nil {
+		httpError(w, r, http.StatusNotFound, "File not found")
+		return
+	}
+
+	if stat.IsDir() {
+		if r.URL.Path != "" && !strings.HasSuffix(r.URL.Path, "/") {
+			redirectToSlash(w, r)
+			return
+		}
+		name = path.Join(name, h.indexFile)
+		stat, err = fs.Stat(h.fsys, name)
+		if err != nil || stat.IsDir() {
+			httpError(w, r, http.StatusForbidden, "Directory listing is not allowed")
+			return
+		}
+	}
+
+	file, err := h.fsys.Open(name)
+	if err != nil {
+		httpError(w, r, http.StatusNotFound, "File not found")
+		return
+	}
+	defer file.Close()
+
+	content, ok := file.(io.ReadSeeker)
+	if !ok {
+		httpError(w, r, http.StatusInternalServerError, "Error accessing file")
+		return
+	}
+
+	setCacheHeaders(w.Header(), h.cacheRules, stat.Name(), h.emitExpires)
+	http.ServeContent(w, r, stat.Name(), stat.ModTime(), content)
+}
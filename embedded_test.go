@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+func newTestEmbeddedSite() fstest.MapFS {
+	return fstest.MapFS{
+		".gitkeep":   {Data: []byte("keep")},
+		"index.html": {Data: []byte("embedded index")},
+		".hidden":    {Data: []byte("secret")},
+	}
+}
+
+func TestEmbeddedHandlerHidesDotfiles(t *testing.T) {
+	h := &embeddedHandler{fsys: newTestEmbeddedSite(), indexFile: "index.html"}
+
+	for path, want := range map[string]int{
+		"/":         http.StatusOK,
+		"/.hidden":  http.StatusNotFound,
+		"/.gitkeep": http.StatusNotFound,
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != want {
+			t.Errorf("GET %s = %d, want %d", path, rec.Code, want)
+		}
+	}
+}
+
+func TestSiteIsEmpty(t *testing.T) {
+	if siteIsEmpty(newTestEmbeddedSite()) {
+		t.Error("siteIsEmpty reported a site with files as empty")
+	}
+	if !siteIsEmpty(fstest.MapFS{".gitkeep": {Data: []byte("keep")}}) {
+		t.Error("siteIsEmpty missed a site holding only .gitkeep")
+	}
+}
@@ -0,0 +1,29 @@
+//go:build embedsite
+
+package main
+
+import (
+	"embed"
+	"io/fs"
+)
+
+// Building with -tags embedsite compiles the contents of the site directory
+// into the binary, to be served with --embedded:
+//
+//	$ cp -r /path/to/site/* site/
+//	$ go build -tags embedsite
+//	$ ./static --embedded
+//
+// The site directory is checked in holding only a .gitkeep; a binary built
+// without copying a site in refuses to start with --embedded.
+//
+//go:embed all:site
+var siteFiles embed.FS
+
+func init() {
+	sub, err := fs.Sub(siteFiles, "site")
+	if err != nil {
+		panic(err)
+	}
+	embeddedSite = sub
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var errorPagesDir string
+
+func httpError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	dropCacheHeaders(w.Header())
+	if prefersJSON(r) {
+		h := w.Header()
+		h.Del("Content-Length")
+		h.Set("Content-Type", "application/json")
+		h.Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":  strings.ToLower(http.StatusText(status)),
+			"status": status,
+		})
+		return
+	}
+
+	switch status {
+	case http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError:
+		if errorPagesDir == "" {
+			break
+		}
+
+		page, err := os.ReadFile(filepath.Join(errorPagesDir, strconv.Itoa(status)+".html"))
+		if err != nil {
+			break
+		}
+
+		h := w.Header()
+		h.Del("Content-Length")
+		h.Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(status)
+		w.Write(page)
+		return
+	}
+
+	http.Error(w, fmt.Sprintf("HTTP %d: Static Server %s - %s", status, serVer, message), status)
+}
+
+// dropCacheHeaders removes the validators and freshness headers a handler
+// may have set for the file before failing, so the error is not cached as
+// if it were the file. A no-store, as maintenance mode sets, is kept.
+func dropCacheHeaders(h http.Header) {
+	noStore := h.Get("Cache-Control") == "no-store"
+	h.Del("Cache-Control")
+	h.Del("Expires")
+	h.Del("Last-Modified")
+	h.Del("ETag")
+	if noStore {
+		h.Set("Cache-Control", "no-store")
+	}
+}
+
+// prefersJSON reports whether the Accept header ranks application/json
+// above text/html, as API clients do and browsers do not.
+func prefersJSON(r *http.Request) bool {
+	jsonQ, htmlQ := -1.0, -1.0
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, _ := strings.Cut(part, ";")
+		switch strings.ToLower(strings.TrimSpace(mediaType)) {
+		case "application/json":
+			jsonQ = parseQuality(params)
+		case "text/html":
+			htmlQ = parseQuality(params)
+		}
+	}
+	return jsonQ > 0 && jsonQ > htmlQ
+}
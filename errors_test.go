@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTTPErrorDropsCacheHeaders(t *testing.T) {
+	for _, accept := range []string{"text/html", "application/json"} {
+		rec := httptest.NewRecorder()
+		h := rec.Header()
+		h.Set("Cache-Control", "public, max-age=86400")
+		h.Set("Expires", time.Now().Add(24*time.Hour).UTC().Format(http.TimeFormat))
+		h.Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		h.Set("ETag", `"abc"`)
+		req := httptest.NewRequest(http.MethodGet, "/a.txt", nil)
+		req.Header.Set("Accept", accept)
+
+		httpError(rec, req, http.StatusInternalServerError, "Error reading file")
+		if rec.Code != http.StatusInternalServerError {
+			t.Errorf("Accept %s: status = %d", accept, rec.Code)
+		}
+		for _, name := range []string{"Cache-Control", "Expires", "Last-Modified", "ETag"} {
+			if v := rec.Header().Get(name); v != "" {
+				t.Errorf("Accept %s: the 500 kept %s: %q", accept, name, v)
+			}
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	rec.Header().Set("Cache-Control", "no-store")
+	httpError(rec, httptest.NewRequest(http.MethodGet, "/", nil), http.StatusServiceUnavailable, "Down for maintenance")
+	if got := rec.Header().Get("Cache-Control"); got != "no-store" {
+		t.Errorf("Cache-Control = %q, want the caller's no-store kept", got)
+	}
+}
+
+func TestBufferedReadErrorIsNotCacheable(t *testing.T) {
+	_, h := newTestSite(t)
+	h.cacheRules = map[string]int{"txt": 3600}
+	h.bufferSize = 1 << 20
+	// A directory opened as a file fails on read, the way a bad disk would.
+	file, err := h.open("sub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	h.serveContent(rec, httptest.NewRequest(http.MethodGet, "/sub.txt", nil), "sub.txt", file, fakeFileInfo{stat, "sub.txt"})
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500", rec.Code)
+	}
+	for _, name := range []string{"Cache-Control", "ETag", "Last-Modified"} {
+		if v := rec.Header().Get(name); v != "" {
+			t.Errorf("the 500 kept %s: %q", name, v)
+		}
+	}
+}
+
+// fakeFileInfo renames a FileInfo and reports it as a regular file.
+type fakeFileInfo struct {
+	os.FileInfo
+	name string
+}
+
+func (fi fakeFileInfo) Name() string { return fi.name }
+func (fi fakeFileInfo) IsDir() bool  { return false }
+
+func TestCustomErrorPages(t *testing.T) {
+	defer func(saved string) { errorPagesDir = saved }(errorPagesDir)
+	dir, h := newTestSite(t)
+	errorPagesDir = dir
+
+	rec := serveRaw(h, "/missing.txt", nil)
+	if rec.Code != http.StatusNotFound || !strings.Contains(rec.Body.String(), "Static Server") {
+		t.Errorf("without 404.html: GET /missing.txt = %d %q, want the built-in 404", rec.Code, rec.Body.String())
+	}
+
+	page := "<h1>Nothing here</h1>"
+	writeTestFile(t, filepath.Join(dir, "404.html"), page)
+	rec = serveRaw(h, "/missing.txt", nil)
+	if rec.Code != http.StatusNotFound || rec.Body.String() != page {
+		t.Errorf("with 404.html: GET /missing.txt = %d %q, want 404 %q", rec.Code, rec.Body.String(), page)
+	}
+	if ctype := rec.Header().Get("Content-Type"); ctype != "text/html; charset=utf-8" {
+		t.Errorf("custom 404 Content-Type = %q, want text/html", ctype)
+	}
+}
+
+func TestJSONErrors(t *testing.T) {
+	dir, cfg := newTestConfig(t)
+	writeTestFile(t, filepath.Join(dir, ".env"), "secret")
+	writeTestFile(t, filepath.Join(dir, "big.txt"), strings.Repeat("x", 100))
+	cfg.files.maxFileSize = 10
+	r := newRouter(cfg)
+	browser := "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"
+
+	for _, c := range []struct {
+		target, accept string
+		status         int
+		json           bool
+	}{
+		{"/static/missing.txt", "application/json", http.StatusNotFound, true},
+		{"/nowhere", "application/json", http.StatusNotFound, true},
+		{"/static/.env", "application/json", http.StatusNotFound, true},
+		{"/static/missing.txt", "text/html;q=0.5, application/json", http.StatusNotFound, true},
+		{"/static/big.txt", "application/json", http.StatusForbidden, true},
+		{"/static/big.txt", browser, http.StatusForbidden, false},
+		{"/static/missing.txt", browser, http.StatusNotFound, false},
+		{"/nowhere", browser, http.StatusNotFound, false},
+		{"/static/missing.txt", "", http.StatusNotFound, false},
+		{"/static/missing.txt", "application/json;q=0, text/plain", http.StatusNotFound, false},
+	} {
+		req := httptest.NewRequest(http.MethodGet, c.target, nil)
+		if c.accept != "" {
+			req.Header.Set("Accept", c.accept)
+		}
+		rec := serveRequest(r, req)
+		if rec.Code != c.status {
+			t.Errorf("GET %s with Accept %q = %d, want %d", c.target, c.accept, rec.Code, c.status)
+			continue
+		}
+
+		ctype := rec.Header().Get("Content-Type")
+		if !c.json {
+			if ctype == "application/json" || !strings.Contains(rec.Body.String(), "Static Server") {
+				t.Errorf("GET %s with Accept %q = %q %q, want the text error", c.target, c.accept, ctype, rec.Body.String())
+			}
+			continue
+		}
+		var body struct {
+			Error  string
+			Status int
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); ctype != "application/json" || err != nil {
+			t.Errorf("GET %s with Accept %q = %q %q, want a JSON error", c.target, c.accept, ctype, rec.Body.String())
+			continue
+		}
+		if want := strings.ToLower(http.StatusText(c.status)); body.Error != want || body.Status != c.status {
+			t.Errorf("GET %s JSON error = %+v, want %q/%d", c.target, body, want, c.status)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const fallbackVia = "1.1 static-server"
+
+// originFallback fetches files missing from the served directory from an
+// upstream origin, optionally saving successful responses next to the
+// local files so the next request is served from disk.
+type originFallback struct {
+	proxy *httputil.ReverseProxy
+	cache bool
+}
+
+func newOriginFallback(origin string, cache bool) (*originFallback, error) {
+	target, err := url.Parse(origin)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, fmt.Errorf("expected an http:// or https:// URL, got %q", origin)
+	}
+
+	f := &originFallback{cache: cache}
+	f.proxy = &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(target)
+			pr.Out.URL.Path = strings.TrimSuffix(target.Path, "/") + path.Clean("/"+pr.In.URL.Path)
+			pr.Out.URL.RawPath = ""
+			pr.Out.Header.Add("Via", fallbackVia)
+			// Credentials for this server mean nothing to the origin.
+			pr.Out.Header.Del("Authorization")
+			pr.Out.Header.Del("Cookie")
+			if _, ok := cachePathFrom(pr.In.Context()); ok {
+				// Ask for the identity encoding so the body can be cached as is.
+				pr.Out.Header.Del("Accept-Encoding")
+			}
+		},
+		ModifyResponse: f.modifyResponse,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			log.Printf("Error fetching %s from fallback origin: %v", r.URL.Path, err)
+			httpError(w, r, http.StatusBadGateway, "Bad gateway")
+		},
+	}
+	return f, nil
+}
+
+type cachePathKey struct{}
+
+func withCachePath(ctx context.Context, filePath string) context.Context {
+	return context.WithValue(ctx, cachePathKey{}, filePath)
+}
+
+func cachePathFrom(ctx context.Context) (string, bool) {
+	filePath, ok := ctx.Value(cachePathKey{}).(string)
+	return filePath, ok
+}
+
+// isLoop reports whether r was already forwarded by a static server, which
+// happens when the origin points back at this server or at another one
+// falling back to us.
+func isLoop(r *http.Request) bool {
+	for _, via := range r.Header.Values("Via") {
+		if strings.Contains(via, fallbackVia) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *originFallback) serve(w http.ResponseWriter, r *http.Request, filePath string) bool {
+	if isLoop(r) {
+		return false
+	}
+	if f.cache && r.Method == http.MethodGet {
+		r = r.WithContext(withCachePath(r.Context(), filePath))
+	}
+	f.proxy.ServeHTTP(w, r)
+	return true
+}
+
+func (f *originFallback) modifyResponse(resp *http.Response) error {
+	filePath, ok := cachePathFrom(resp.Request.Context())
+	if !ok || resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Encoding") != "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		log.Printf("Error caching %s: %v", filePath, err)
+		return nil
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), ".fallback-*")
+	if err != nil {
+		log.Printf("Error caching %s: %v", filePath, err)
+		return nil
+	}
+	resp.Body = &cachingBody{ReadCloser: resp.Body, tmp: tmp, dest: filePath, want: resp.ContentLength}
+	return nil
+}
+
+// cachingBody copies the upstream body into a temporary file and moves it
+// into place only once the whole body has been read, so an aborted
+// transfer never leaves a truncated file behind.
+type cachingBody struct {
+	io.ReadCloser
+	tmp  *os.File
+	dest string
+	want int64
+	got  int64
+	err  error
+	done bool
+}
+
+func (b *cachingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 && b.err == nil {
+		_, b.err = b.tmp.Write(p[:n])
+		b.got += int64(n)
+	}
+	if err == io.EOF {
+		b.done = true
+	}
+	return n, err
+}
+
+func (b *cachingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.tmp.Close()
+
+	if !b.done || b.err != nil || (b.want >= 0 && b.got != b.want) {
+		os.Remove(b.tmp.Name())
+		return err
+	}
+	if renameErr := os.Rename(b.tmp.Name(), b.dest); renameErr != nil {
+		log.Printf("Error caching %s: %v", b.dest, renameErr)
+		os.Remove(b.tmp.Name())
+	}
+	return err
+}
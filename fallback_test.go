@@ -0,0 +1,125 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestOriginFallbackStripsCredentials(t *testing.T) {
+	var got http.Header
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		w.Write([]byte("from origin"))
+	}))
+	defer origin.Close()
+
+	f, err := newOriginFallback(origin.URL, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/missing.txt", nil)
+	req.SetBasicAuth("u", "p")
+	req.Header.Set("Cookie", "session=secret")
+	rec := httptest.NewRecorder()
+	if !f.serve(rec, req, "") {
+		t.Fatal("serve declined a request that was not a loop")
+	}
+
+	if rec.Code != http.StatusOK || rec.Body.String() != "from origin" {
+		t.Fatalf("fallback = %d %q, want 200 \"from origin\"", rec.Code, rec.Body.String())
+	}
+	for _, name := range []string{"Authorization", "Cookie"} {
+		if v := got.Get(name); v != "" {
+			t.Errorf("origin received %s: %q", name, v)
+		}
+	}
+	if v := got.Get("Via"); v != fallbackVia {
+		t.Errorf("origin received Via %q, want %q", v, fallbackVia)
+	}
+}
+
+// newFallbackOrigin serves hello.txt and records the paths it was asked for.
+func newFallbackOrigin(t *testing.T) (*httptest.Server, *[]string) {
+	t.Helper()
+	var mu sync.Mutex
+	var paths []string
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		mu.Unlock()
+		if path.Base(r.URL.Path) != "hello.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("from origin"))
+	}))
+	t.Cleanup(origin.Close)
+	return origin, &paths
+}
+
+func TestOriginFallbackThroughRouter(t *testing.T) {
+	for _, cache := range []bool{false, true} {
+		origin, paths := newFallbackOrigin(t)
+		dir, cfg := newTestConfig(t)
+		mountDir := t.TempDir()
+		cfg.mounts = []mount{{prefix: "/m/", dir: mountDir}}
+		f, err := newOriginFallback(origin.URL+"/assets", cache)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg.files.fallback = f
+		r := newRouter(cfg)
+
+		get := func(target string) *httptest.ResponseRecorder {
+			return serveRequest(r, httptest.NewRequest(http.MethodGet, target, nil))
+		}
+
+		if rec := get("/static/a.txt"); rec.Code != http.StatusOK || rec.Body.String() != "hello" {
+			t.Errorf("cache=%v: local file = %d %q", cache, rec.Code, rec.Body.String())
+		}
+		if len(*paths) != 0 {
+			t.Errorf("cache=%v: a local file reached the origin: %v", cache, *paths)
+		}
+
+		for _, target := range []string{"/static/sub/hello.txt", "/m/sub/hello.txt"} {
+			if rec := get(target); rec.Code != http.StatusOK || rec.Body.String() != "from origin" {
+				t.Errorf("cache=%v: GET %s = %d %q, want the origin's file", cache, target, rec.Code, rec.Body.String())
+			}
+		}
+		if rec := get("/static/nope.txt"); rec.Code != http.StatusNotFound {
+			t.Errorf("cache=%v: origin miss = %d, want 404", cache, rec.Code)
+		}
+		want := []string{"/assets/sub/hello.txt", "/assets/sub/hello.txt", "/assets/nope.txt"}
+		if !slices.Equal(*paths, want) {
+			t.Errorf("cache=%v: origin saw %v, want %v", cache, *paths, want)
+		}
+
+		for _, cached := range []string{filepath.Join(dir, "sub", "hello.txt"), filepath.Join(mountDir, "sub", "hello.txt")} {
+			data, err := os.ReadFile(cached)
+			if cache && string(data) != "from origin" {
+				t.Errorf("cache=%v: %s = %q, %v; want the origin's file", cache, cached, data, err)
+			}
+			if !cache && err == nil {
+				t.Errorf("cache=%v: %s was written", cache, cached)
+			}
+		}
+		if _, err := os.Stat(filepath.Join(dir, "nope.txt")); err == nil {
+			t.Errorf("cache=%v: the origin's 404 was cached", cache)
+		}
+
+		if cache {
+			origin.Close()
+			if rec := get("/static/sub/hello.txt"); rec.Code != http.StatusOK || rec.Body.String() != "from origin" {
+				t.Errorf("cached file with the origin down = %d %q", rec.Code, rec.Body.String())
+			}
+		}
+	}
+}
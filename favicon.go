@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"html/template"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+//go:embed favicon.ico
+var defaultFavicon []byte
+
+//go:embed assets/index.html
+var defaultIndexHTML string
+
+var defaultIndexPage = template.Must(template.New("index").Parse(defaultIndexHTML))
+
+const maxFaviconSize = 1 << 20
+
+func validFaviconURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("expected an http:// or https:// URL, got %q", rawURL)
+	}
+	return nil
+}
+
+func serveFavicon(w http.ResponseWriter, r *http.Request, faviconPath string) {
+	if file, stat, err := openRegularFile(faviconPath); err == nil {
+		defer file.Close()
+		head := make([]byte, 512)
+		n, _ := io.ReadFull(file, head)
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			httpError(w, r, http.StatusInternalServerError, "Error reading file")
+			return
+		}
+		w.Header().Set("Content-Type", faviconContentType(faviconPath, head[:n]))
+		http.ServeContent(w, r, stat.Name(), stat.ModTime(), file)
+		return
+	}
+	w.Header().Set("Content-Type", "image/x-icon")
+	http.ServeContent(w, r, "favicon.ico", startTime, bytes.NewReader(defaultFavicon))
+}
+
+// faviconContentType works out the type of a favicon from its first bytes,
+// since a PNG or SVG saved as favicon.ico is common. SVG sniffs as XML or
+// text, so it is recognised by its root element; anything else unknown
+// falls back to the extension and then to image/x-icon.
+func faviconContentType(name string, head []byte) string {
+	ctype := http.DetectContentType(head)
+	if strings.HasPrefix(ctype, "image/") {
+		return ctype
+	}
+	if strings.HasPrefix(ctype, "text/") && bytes.Contains(head, []byte("<svg")) {
+		return "image/svg+xml"
+	}
+	if ctype := mime.TypeByExtension(filepath.Ext(name)); strings.HasPrefix(ctype, "image/") {
+		return ctype
+	}
+	return "image/x-icon"
+}
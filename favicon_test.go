@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+func TestFaviconFromDirectory(t *testing.T) {
+	dir, cfg := newTestConfig(t)
+	icon := "\x00\x00\x01\x00custom icon"
+	writeTestFile(t, filepath.Join(dir, "favicon.ico"), icon)
+	cfg.faviconPath = filepath.Join(dir, "favicon.ico")
+	r := newRouter(cfg)
+
+	rec := serveRequest(r, httptest.NewRequest(http.MethodGet, "/favicon.ico", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != icon {
+		t.Errorf("GET /favicon.ico = %d %q, want the directory's favicon", rec.Code, rec.Body.String())
+	}
+}
+
+func TestFaviconDefault(t *testing.T) {
+	dir, cfg := newTestConfig(t)
+	cfg.faviconPath = filepath.Join(dir, "favicon.ico")
+	r := newRouter(cfg)
+
+	rec := serveRequest(r, httptest.NewRequest(http.MethodGet, "/favicon.ico", nil))
+	if rec.Code != http.StatusOK || !bytes.Equal(rec.Body.Bytes(), defaultFavicon) {
+		t.Errorf("GET /favicon.ico without a file = %d, %d bytes; want the built-in favicon", rec.Code, rec.Body.Len())
+	}
+	if ctype := rec.Header().Get("Content-Type"); ctype != "image/x-icon" {
+		t.Errorf("Content-Type = %q, want image/x-icon", ctype)
+	}
+}
+
+func TestEmbeddedFaviconWithEmptyDirectory(t *testing.T) {
+	dir := t.TempDir()
+	addr, _, _ := startServer(t, "--directory", dir)
+
+	resp, err := http.Get("http://" + addr + "/favicon.ico")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || !bytes.Equal(body, defaultFavicon) {
+		t.Errorf("GET /favicon.ico from an empty directory = %d, %d bytes; want the embedded favicon", resp.StatusCode, len(body))
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("startup wrote %d files into the empty directory", len(entries))
+	}
+}
+
+func TestFaviconURLDownload(t *testing.T) {
+	icon := []byte("\x00\x00\x01\x00from the stub")
+	var fetches atomic.Int32
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		w.Write(icon)
+	}))
+	defer origin.Close()
+	dir := t.TempDir()
+	addr, _, _ := startServer(t, "--directory", dir, "--favicon-url", origin.URL+"/favicon.ico")
+
+	resp, err := http.Get("http://" + addr + "/favicon.ico")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || !bytes.Equal(body, icon) {
+		t.Errorf("GET /favicon.ico = %d %q, want the downloaded favicon", resp.StatusCode, body)
+	}
+	if saved, err := os.ReadFile(filepath.Join(dir, "favicon.ico")); err != nil || !bytes.Equal(saved, icon) {
+		t.Errorf("saved favicon = %q (err %v), want %q", saved, err, icon)
+	}
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("stub favicon fetched %d times, want 1", n)
+	}
+}
+
+func TestValidFaviconURL(t *testing.T) {
+	for _, rawURL := range []string{"http://example.com/favicon.ico", "https://example.com/f.ico"} {
+		if err := validFaviconURL(rawURL); err != nil {
+			t.Errorf("validFaviconURL(%q) = %v", rawURL, err)
+		}
+	}
+	for _, rawURL := range []string{"ftp://example.com/favicon.ico", "file:///etc/passwd", "example.com/favicon.ico", "https://"} {
+		if err := validFaviconURL(rawURL); err == nil {
+			t.Errorf("validFaviconURL(%q) accepted", rawURL)
+		}
+	}
+}
+
+func TestNoFavicon(t *testing.T) {
+	dir, cfg := newTestConfig(t)
+	writeTestFile(t, filepath.Join(dir, "favicon.ico"), "icon")
+	cfg.faviconPath = filepath.Join(dir, "favicon.ico")
+	cfg.favicon = false
+
+	rec := serveRequest(newRouter(cfg), httptest.NewRequest(http.MethodGet, "/favicon.ico", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("--no-favicon: GET /favicon.ico = %d, want 404", rec.Code)
+	}
+}
+
+func TestNoFaviconSkipsDownload(t *testing.T) {
+	var fetches atomic.Int32
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+	}))
+	defer origin.Close()
+	addr, _, _ := startServer(t, "--directory", t.TempDir(), "--favicon-url", origin.URL, "--no-favicon")
+
+	resp, err := http.Get("http://" + addr + "/favicon.ico")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound || fetches.Load() != 0 {
+		t.Errorf("--no-favicon: GET /favicon.ico = %d after %d downloads, want 404 and none", resp.StatusCode, fetches.Load())
+	}
+}
+
+func TestFaviconContentType(t *testing.T) {
+	png := "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"
+	svg := `<?xml version="1.0"?><svg xmlns="http://www.w3.org/2000/svg"></svg>`
+	for _, c := range []struct {
+		name, content, want string
+	}{
+		{"favicon.png", png, "image/png"},
+		{"favicon.ico", png, "image/png"},
+		{"favicon.svg", svg, "image/svg+xml"},
+		{"favicon.ico", svg, "image/svg+xml"},
+		{"favicon.gif", "not really a gif", "image/gif"},
+		{"favicon.ico", "\x00\x00\x01\x00icon", "image/x-icon"},
+		{"favicon", "unknown bytes", "image/x-icon"},
+	} {
+		dir, cfg := newTestConfig(t)
+		writeTestFile(t, filepath.Join(dir, c.name), c.content)
+		cfg.faviconPath = filepath.Join(dir, c.name)
+
+		rec := serveRequest(newRouter(cfg), httptest.NewRequest(http.MethodGet, "/favicon.ico", nil))
+		if ctype := rec.Header().Get("Content-Type"); rec.Code != http.StatusOK || ctype != c.want {
+			t.Errorf("%s holding %q: GET /favicon.ico = %d %q, want %q", c.name, c.content, rec.Code, ctype, c.want)
+		}
+		if rec.Body.String() != c.content {
+			t.Errorf("%s: body = %q, want the file from its first byte", c.name, rec.Body.String())
+		}
+	}
+}
@@ -1,5 +1,16 @@
 module github.com/donuts-are-good/static
 
-go 1.22.0
+go 1.24.0
 
-require github.com/gorilla/mux v1.8.1
+require (
+	github.com/andybalholm/brotli v1.1.1
+	github.com/fsnotify/fsnotify v1.7.0
+	github.com/gorilla/mux v1.8.1
+	golang.org/x/crypto v0.31.0
+	golang.org/x/net v0.33.0
+)
+
+require (
+	golang.org/x/sys v0.28.0 // indirect
+	golang.org/x/text v0.21.0 // indirect
+)
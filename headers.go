@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type headerRule struct {
+	pattern string
+	name    string
+	value   string
+}
+
+type headerList []headerRule
+
+func (l *headerList) String() string {
+	parts := make([]string, len(*l))
+	for i, rule := range *l {
+		parts[i] = rule.pattern + ":" + rule.name + ":" + rule.value
+	}
+	return strings.Join(parts, ",")
+}
+
+func (l *headerList) Set(value string) error {
+	parts := strings.SplitN(value, ":", 3)
+	if len(parts) != 3 || parts[0] == "" || strings.TrimSpace(parts[1]) == "" {
+		return fmt.Errorf("expected pathglob:Header-Name:value, got %q", value)
+	}
+	if _, err := path.Match(parts[0], ""); err != nil {
+		return fmt.Errorf("invalid path glob %q", parts[0])
+	}
+	*l = append(*l, headerRule{
+		pattern: parts[0],
+		name:    http.CanonicalHeaderKey(strings.TrimSpace(parts[1])),
+		value:   strings.TrimSpace(parts[2]),
+	})
+	return nil
+}
+
+func customHeadersMiddleware(rules headerList) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, rule := range rules {
+				if ok, _ := path.Match(rule.pattern, r.URL.Path); ok {
+					w.Header().Set(rule.name, rule.value)
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func serverHeadersMiddleware(hideVersion bool) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !hideVersion {
+				w.Header().Set("Server", "Static-Server/"+serVer)
+			}
+			w.Header().Set("X-Uptime-Seconds", strconv.Itoa(int(time.Since(startTime).Seconds())))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
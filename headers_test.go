@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestCustomHeaders(t *testing.T) {
+	dir, cfg := newTestConfig(t)
+	writeTestFile(t, filepath.Join(dir, "app.wasm"), "\x00asm")
+	writeTestFile(t, filepath.Join(dir, "sub", "app.wasm"), "\x00asm")
+	for _, spec := range []string{
+		"/static/*.wasm:Cross-Origin-Embedder-Policy:require-corp",
+		"/static/*:x-frame-extra: one",
+	} {
+		if err := cfg.headers.Set(spec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := newRouter(cfg)
+
+	cases := []struct {
+		target          string
+		wantCOEP, extra string
+	}{
+		{"/static/app.wasm", "require-corp", "one"},
+		{"/static/a.txt", "", "one"},
+		// A glob's * does not cross a slash.
+		{"/static/sub/app.wasm", "", ""},
+	}
+	for _, c := range cases {
+		rec := serveRouter(r, http.MethodGet, c.target, "")
+		if got := rec.Header().Get("Cross-Origin-Embedder-Policy"); got != c.wantCOEP {
+			t.Errorf("GET %s: Cross-Origin-Embedder-Policy = %q, want %q", c.target, got, c.wantCOEP)
+		}
+		if got := rec.Header().Get("X-Frame-Extra"); got != c.extra {
+			t.Errorf("GET %s: X-Frame-Extra = %q, want %q", c.target, got, c.extra)
+		}
+	}
+}
+
+func TestHeaderListSetErrors(t *testing.T) {
+	for _, spec := range []string{"", "/static/*.wasm", "/static/*.wasm:", ":X-A:b", "/static/[:X-A:b"} {
+		var l headerList
+		if err := l.Set(spec); err == nil {
+			t.Errorf("--header %q accepted", spec)
+		}
+	}
+}
+
+func TestServerHeaders(t *testing.T) {
+	_, cfg := newTestConfig(t)
+	for _, hide := range []bool{false, true} {
+		cfg.hideVersion = hide
+		r := newRouter(cfg)
+		for _, target := range []string{"/static/a.txt", "/", "/static/missing.txt", "/healthz"} {
+			rec := serveRouter(r, http.MethodGet, target, "")
+			wantServer := "Static-Server/" + serVer
+			if hide {
+				wantServer = ""
+			}
+			if got := rec.Header().Get("Server"); got != wantServer {
+				t.Errorf("--hide-version=%v: GET %s Server = %q, want %q", hide, target, got, wantServer)
+			}
+			if uptime, err := strconv.Atoi(rec.Header().Get("X-Uptime-Seconds")); err != nil || uptime < 0 {
+				t.Errorf("--hide-version=%v: GET %s X-Uptime-Seconds = %q, want seconds", hide, target, rec.Header().Get("X-Uptime-Seconds"))
+			}
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+type integrityEntry struct {
+	modTime time.Time
+	size    int64
+	hash    string
+}
+
+// integrityCache remembers SRI hashes by file path until the file's mtime
+// or size changes. It also backs --etag-mode hash.
+type integrityCache struct {
+	mu      sync.Mutex
+	entries map[string]integrityEntry
+}
+
+func newIntegrityCache() *integrityCache {
+	return &integrityCache{entries: map[string]integrityEntry{}}
+}
+
+func (c *integrityCache) hash(files *staticHandler, name string) (string, error) {
+	file, stat, err := files.openRegular(name)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	return c.hashFile(filepath.Join(files.dir, filepath.FromSlash(name)), file, stat)
+}
+
+// hashFile returns the hash of an open file, reading it only when there is
+// no entry for key with the same mtime and size. The read position is left
+// wherever hashing stopped.
+func (c *integrityCache) hashFile(key string, file io.Reader, stat os.FileInfo) (string, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && entry.modTime.Equal(stat.ModTime()) && entry.size == stat.Size() {
+		return entry.hash, nil
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	hash := "sha256-" + base64.StdEncoding.EncodeToString(h.Sum(nil))
+
+	c.mu.Lock()
+	c.entries[key] = integrityEntry{modTime: stat.ModTime(), size: stat.Size(), hash: hash}
+	c.mu.Unlock()
+	return hash, nil
+}
+
+type integrityRoot struct {
+	prefix string
+	files  *staticHandler
+}
+
+// integrityHandler answers /integrity?path=/static/app.js with the
+// subresource integrity hash of the file that URL would serve.
+func integrityHandler(roots []integrityRoot, cache *integrityCache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		urlPath := r.URL.Query().Get("path")
+		if urlPath == "" {
+			httpError(w, r, http.StatusBadRequest, "Missing path parameter")
+			return
+		}
+
+		for _, root := range roots {
+			rel, ok := strings.CutPrefix(urlPath, root.prefix)
+			if !ok {
+				continue
+			}
+			if !root.files.dotfiles && hasDotComponent(rel) || hasBlockedExt(root.files.blockedExts, rel) {
+				break
+			}
+
+			if _, ok := resolvePath(root.files.dir, rel); !ok {
+				httpError(w, r, http.StatusForbidden, "Access denied")
+				return
+			}
+
+			hash, err := cache.hash(root.files, rootName(rel))
+			if err != nil && !isNotExist(err) {
+				httpError(w, r, http.StatusForbidden, "Access denied")
+				return
+			}
+			if err != nil {
+				break
+			}
+
+			jsonData, err := marshalJSON(r, map[string]string{"Path": urlPath, "Integrity": hash})
+			if err != nil {
+				httpError(w, r, http.StatusInternalServerError, err.Error())
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Write(jsonData)
+			return
+		}
+
+		httpError(w, r, http.StatusNotFound, "File not found")
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestIntegrity(t *testing.T) {
+	dir, cfg := newTestConfig(t)
+	js := "console.log('app');\n"
+	writeTestFile(t, filepath.Join(dir, "app.js"), js)
+	writeTestFile(t, filepath.Join(filepath.Dir(dir), "outside.js"), "secret")
+	writeTestFile(t, filepath.Join(dir, ".hidden.js"), "hidden")
+	r := newRouter(cfg)
+	sum := sha256.Sum256([]byte(js))
+	want := "sha256-" + base64.StdEncoding.EncodeToString(sum[:])
+
+	get := func(path string) (int, map[string]string) {
+		t.Helper()
+		rec := serveRouter(r, http.MethodGet, "/integrity?path="+url.QueryEscape(path), "")
+		var data map[string]string
+		json.Unmarshal(rec.Body.Bytes(), &data)
+		return rec.Code, data
+	}
+
+	if code, data := get("/static/app.js"); code != http.StatusOK || data["Integrity"] != want || data["Path"] != "/static/app.js" {
+		t.Errorf("/integrity for /static/app.js = %d %v, want %s", code, data, want)
+	}
+
+	for _, c := range []struct {
+		path string
+		want int
+	}{
+		{"/static/../outside.js", http.StatusNotFound},
+		{"/static/sub/../../outside.js", http.StatusNotFound},
+		{"/static/.hidden.js", http.StatusNotFound},
+		{"/static/missing.js", http.StatusNotFound},
+		{"/elsewhere/app.js", http.StatusNotFound},
+	} {
+		if code, _ := get(c.path); code != c.want {
+			t.Errorf("/integrity for %s = %d, want %d", c.path, code, c.want)
+		}
+	}
+	if rec := serveRouter(r, http.MethodGet, "/integrity", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("/integrity without a path = %d, want 400", rec.Code)
+	}
+
+	// A changed file gets a new hash once its mtime moves.
+	writeTestFile(t, filepath.Join(dir, "app.js"), "changed")
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(filepath.Join(dir, "app.js"), later, later)
+	sum = sha256.Sum256([]byte("changed"))
+	if _, data := get("/static/app.js"); data["Integrity"] != "sha256-"+base64.StdEncoding.EncodeToString(sum[:]) {
+		t.Errorf("/integrity after a change = %v, want the new hash", data)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+func parseCIDRs(spec string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		if !strings.Contains(part, "/") {
+			addr, err := netip.ParseAddr(part)
+			if err != nil {
+				return nil, fmt.Errorf("invalid address or CIDR %q", part)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q", part)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+func validDefaultPolicy(policy string) error {
+	switch policy {
+	case "allow", "deny":
+		return nil
+	}
+	return fmt.Errorf("unknown default policy %q (expected allow or deny)", policy)
+}
+
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ipFilterMiddleware rejects clients matching deny, then admits those
+// matching allow, and applies defaultPolicy to everyone else, including
+// clients without an IP such as those on a Unix socket. Health probes are
+// always let through.
+func ipFilterMiddleware(allow, deny []netip.Prefix, defaultPolicy string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isHealthProbe(r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			permitted := defaultPolicy == "allow"
+			if addr, err := netip.ParseAddr(clientIP(r)); err == nil {
+				addr = addr.Unmap()
+				switch {
+				case containsAddr(deny, addr):
+					permitted = false
+				case containsAddr(allow, addr):
+					permitted = true
+				}
+			}
+
+			if !permitted {
+				httpError(w, r, http.StatusForbidden, "Access denied")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
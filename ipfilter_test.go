@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestParseCIDRs(t *testing.T) {
+	prefixes, err := parseCIDRs("10.0.0.0/8, 192.168.1.7, ::1,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"10.0.0.0/8", "192.168.1.7/32", "::1/128"}
+	if len(prefixes) != len(want) {
+		t.Fatalf("parseCIDRs = %v, want %v", prefixes, want)
+	}
+	for i, p := range prefixes {
+		if p.String() != want[i] {
+			t.Errorf("prefix %d = %s, want %s", i, p, want[i])
+		}
+	}
+
+	for _, spec := range []string{"10.0.0.300", "10.0.0.0/33", "example.com"} {
+		if _, err := parseCIDRs(spec); err == nil {
+			t.Errorf("parseCIDRs(%q) succeeded, want an error", spec)
+		}
+	}
+}
+
+func TestIPFilterMiddleware(t *testing.T) {
+	allow, _ := parseCIDRs("10.0.0.0/8")
+	deny, _ := parseCIDRs("10.0.0.66")
+
+	cases := []struct {
+		policy, remoteAddr string
+		want               int
+	}{
+		{"deny", "10.1.2.3:1234", http.StatusOK},
+		{"deny", "10.0.0.66:1234", http.StatusForbidden},
+		{"deny", "192.0.2.1:1234", http.StatusForbidden},
+		{"deny", "[::ffff:10.1.2.3]:1234", http.StatusOK},
+		{"deny", "@", http.StatusForbidden},
+		{"allow", "192.0.2.1:1234", http.StatusOK},
+		{"allow", "10.0.0.66:1234", http.StatusForbidden},
+		{"allow", "@", http.StatusOK},
+	}
+	for _, c := range cases {
+		r := newTestRouter(ipFilterMiddleware(allow, deny, c.policy))
+		for _, target := range []string{"/stats", "/app/route"} {
+			if rec := serveRouter(r, http.MethodGet, target, c.remoteAddr); rec.Code != c.want {
+				t.Errorf("policy %s, client %s: GET %s = %d, want %d", c.policy, c.remoteAddr, target, rec.Code, c.want)
+			}
+		}
+	}
+}
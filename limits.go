@@ -0,0 +1,109 @@
+package main
+
+import (
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func maxRequestSizeMiddleware(limit int64) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > limit {
+				w.Header().Set("Connection", "close")
+				httpError(w, r, http.StatusRequestEntityTooLarge, "Request body too large")
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+const maxDrainBytes = 64 << 10
+
+// drainBodyMiddleware reads and discards request bodies, which no handler
+// here uses, so the connection can be reused for the next request. Bodies
+// larger than maxDrainBytes are not worth reading; the connection is closed
+// after the response instead.
+func drainBodyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Body != nil && r.Body != http.NoBody {
+			n, _ := io.CopyN(io.Discard, r.Body, maxDrainBytes+1)
+			if n > maxDrainBytes {
+				w.Header().Set("Connection", "close")
+			}
+			r.Body.Close()
+			r.Body = http.NoBody
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allowedMethodsMiddleware answers 405 for anything but GET and HEAD.
+// OPTIONS is let through when allowOptions is set so CORS preflight
+// requests reach corsMiddleware, and POST for the admin postPaths.
+func allowedMethodsMiddleware(allowOptions bool, postPaths ...string) mux.MiddlewareFunc {
+	allow := "GET, HEAD"
+	if allowOptions {
+		allow += ", OPTIONS"
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.Method == http.MethodGet, r.Method == http.MethodHead:
+			case r.Method == http.MethodOptions && allowOptions:
+			case r.Method == http.MethodPost && slices.Contains(postPaths, r.URL.Path):
+			default:
+				w.Header().Set("Allow", allow)
+				httpError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// isHealthProbe reports whether urlPath is one of the load balancer health
+// checks, which bypass maintenance mode, the IP filter, rate limiting and
+// the concurrency cap so that a busy server is not taken out of rotation.
+func isHealthProbe(urlPath string) bool {
+	return urlPath == "/healthz" || urlPath == "/readyz"
+}
+
+// maxConcurrentMiddleware lets at most limit requests run at once. Others
+// wait up to queueTimeout for a slot before getting a 503. Health probes
+// are not counted.
+func maxConcurrentMiddleware(limit int, queueTimeout time.Duration) mux.MiddlewareFunc {
+	slots := make(chan struct{}, limit)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isHealthProbe(r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			timer := time.NewTimer(queueTimeout)
+			defer timer.Stop()
+
+			select {
+			case slots <- struct{}{}:
+			case <-timer.C:
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Max(1, math.Ceil(queueTimeout.Seconds())))))
+				httpError(w, r, http.StatusServiceUnavailable, "Server busy")
+				return
+			case <-r.Context().Done():
+				return
+			}
+			defer func() { <-slots }()
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
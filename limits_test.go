@@ -0,0 +1,163 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestAllowedMethodsOnNotFoundPath(t *testing.T) {
+	for _, spa := range []bool{true, false} {
+		r := mux.NewRouter()
+		r.HandleFunc("/stats/reset", func(w http.ResponseWriter, r *http.Request) {}).Methods(http.MethodPost)
+		r.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if spa {
+				w.Write([]byte("spa index"))
+				return
+			}
+			httpError(w, r, http.StatusNotFound, "That file was not found")
+		})
+		useMiddleware(r, allowedMethodsMiddleware(false, "/stats/reset"))
+
+		rec := serveRouter(r, http.MethodDelete, "/x", "")
+		if rec.Code != http.StatusMethodNotAllowed {
+			t.Errorf("spa=%v: DELETE /x = %d, want 405", spa, rec.Code)
+		}
+		if got := rec.Header().Get("Allow"); got != "GET, HEAD" {
+			t.Errorf("spa=%v: Allow = %q, want %q", spa, got, "GET, HEAD")
+		}
+
+		want := http.StatusOK
+		if !spa {
+			want = http.StatusNotFound
+		}
+		if rec := serveRouter(r, http.MethodGet, "/x", ""); rec.Code != want {
+			t.Errorf("spa=%v: GET /x = %d, want %d", spa, rec.Code, want)
+		}
+		if rec := serveRouter(r, http.MethodPost, "/stats/reset", ""); rec.Code != http.StatusOK {
+			t.Errorf("spa=%v: POST /stats/reset = %d, want 200", spa, rec.Code)
+		}
+	}
+}
+
+func TestMaxRequestSize(t *testing.T) {
+	_, cfg := newTestConfig(t)
+	cfg.maxRequestSize = 16
+	r := newRouter(cfg)
+
+	for _, c := range []struct {
+		body string
+		want int
+	}{
+		{"small", http.StatusOK},
+		{strings.Repeat("x", 17), http.StatusRequestEntityTooLarge},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/static/a.txt", strings.NewReader(c.body))
+		rec := serveRequest(r, req)
+		if rec.Code != c.want {
+			t.Errorf("GET with a %d byte body = %d, want %d", len(c.body), rec.Code, c.want)
+		}
+		if c.want == http.StatusRequestEntityTooLarge && rec.Header().Get("Connection") != "close" {
+			t.Errorf("oversized body: Connection = %q, want close", rec.Header().Get("Connection"))
+		}
+	}
+}
+
+func TestMaxConcurrent(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 2)
+	h := maxConcurrentMiddleware(2, 50*time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			started <- struct{}{}
+			<-release
+		}
+	}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			serveRouter(h, http.MethodGet, "/slow", "")
+		}()
+	}
+	<-started
+	<-started
+
+	rec := serveRouter(h, http.MethodGet, "/fast", "")
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") != "1" {
+		t.Errorf("request past the limit = %d Retry-After %q, want 503 and 1", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if rec := serveRouter(h, http.MethodGet, "/healthz", ""); rec.Code != http.StatusOK {
+		t.Errorf("health probe while saturated = %d, want 200", rec.Code)
+	}
+
+	close(release)
+	wg.Wait()
+	if rec := serveRouter(h, http.MethodGet, "/fast", ""); rec.Code != http.StatusOK {
+		t.Errorf("request after the slow ones finished = %d, want 200", rec.Code)
+	}
+}
+
+func TestMaxConcurrentReleasesOnPanic(t *testing.T) {
+	h := recoverMiddleware(maxConcurrentMiddleware(1, 50*time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/panic" {
+			panic("handler bug")
+		}
+	})))
+
+	var logs syncBuffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+	serveRouter(h, http.MethodGet, "/panic", "")
+	if rec := serveRouter(h, http.MethodGet, "/fast", ""); rec.Code != http.StatusOK {
+		t.Errorf("request after a panic = %d, want 200: the panicking request kept its slot", rec.Code)
+	}
+}
+
+func TestBodyDrainKeepsConnectionReusable(t *testing.T) {
+	_, cfg := newTestConfig(t)
+	srv := httptest.NewServer(newRouter(cfg))
+	defer srv.Close()
+	client := srv.Client()
+
+	get := func(body string) (reused, closed bool) {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/static/a.txt", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = req.WithContext(httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+			GotConn: func(info httptrace.GotConnInfo) { reused = info.Reused },
+		}))
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return reused, resp.Close
+	}
+
+	get("")
+	if reused, _ := get("a small body on a GET"); !reused {
+		t.Error("GET with a small body did not reuse the idle connection")
+	}
+	if reused, _ := get(""); !reused {
+		t.Error("connection was not reusable after a GET with a small body")
+	}
+
+	// Bodies past the drain limit are not read; the connection closes.
+	if _, closed := get(strings.Repeat("x", maxDrainBytes+1)); !closed {
+		t.Errorf("GET with a %d byte body kept the connection open, want Connection: close", maxDrainBytes+1)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// sdListenFDsStart is the first file descriptor systemd passes to a
+// socket-activated service.
+const sdListenFDsStart = 3
+
+// inheritedFD returns the listening socket to take over instead of opening
+// a new one: the --listen-fd value if set, otherwise the first socket from
+// systemd's LISTEN_FDS when it was meant for this process, otherwise 0.
+func inheritedFD(flagFD int) int {
+	if flagFD > 0 {
+		return flagFD
+	}
+	if os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 1 {
+		return 0
+	}
+	// Keep child processes, such as the browser opened by --open, from
+	// thinking the sockets are theirs.
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	return sdListenFDsStart
+}
+
+func fileListener(fd int) (net.Listener, error) {
+	f := os.NewFile(uintptr(fd), "listen-fd-"+strconv.Itoa(fd))
+	if f == nil {
+		return nil, fmt.Errorf("file descriptor %d is not valid", fd)
+	}
+	defer f.Close()
+
+	ln, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("file descriptor %d is not a listening socket: %w", fd, err)
+	}
+	return ln, nil
+}
+
+func listen(socketPath, addr string) (net.Listener, error) {
+	if socketPath == "" {
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			return nil, describeListenError(addr, err)
+		}
+		return ln, nil
+	}
+
+	if err := removeStaleSocket(socketPath); err != nil {
+		return nil, err
+	}
+	return net.Listen("unix", socketPath)
+}
+
+func removeStaleSocket(socketPath string) error {
+	stat, err := os.Lstat(socketPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if stat.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", socketPath)
+	}
+	if conn, err := net.Dial("unix", socketPath); err == nil {
+		conn.Close()
+		return fmt.Errorf("%s is in use by another process", socketPath)
+	}
+	return os.Remove(socketPath)
+}
+
+func describeListenError(addr string, err error) error {
+	_, port, _ := net.SplitHostPort(addr)
+	switch {
+	case errors.Is(err, syscall.EADDRINUSE):
+		return fmt.Errorf("port %s is already in use by another process (%w)", port, err)
+	case errors.Is(err, syscall.EACCES):
+		return fmt.Errorf("permission denied binding port %s; ports below 1024 usually need root (%w)", port, err)
+	}
+	return err
+}
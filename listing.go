@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+type listingEntry struct {
+	Name      string
+	URL       string
+	Size      int64
+	HumanSize string
+	ModTime   time.Time
+	IsDir     bool
+}
+
+type listingPage struct {
+	Path    string
+	Entries []listingEntry
+	Version string
+
+	// Sort and Order describe the current ordering; the *SortURL fields
+	// link to the listing sorted by that column, toggling the order when
+	// it is already the sort column.
+	Sort        string
+	Order       string
+	NameSortURL string
+	SizeSortURL string
+	TimeSortURL string
+}
+
+var defaultListingTemplate = template.Must(template.New("listing").Parse(`<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="utf-8">
+	<title>Index of {{.Path}}</title>
+	<style>
+			body {
+					font-family: monospace, sans-serif;
+					margin: 2em;
+			}
+			td, th {
+					padding: 0 1em 0 0;
+					text-align: left;
+			}
+	</style>
+</head>
+<body>
+	<h1>Index of {{.Path}}</h1>
+	<table>
+			<tr><th><a href="{{.NameSortURL}}">Name</a></th><th><a href="{{.SizeSortURL}}">Size</a></th><th><a href="{{.TimeSortURL}}">Modified</a></th></tr>
+			<tr><td><a href="../">../</a></td><td></td><td></td></tr>
+{{- range .Entries}}
+			<tr><td><a href="{{.URL}}">{{.Name}}{{if .IsDir}}/{{end}}</a></td><td>{{if not .IsDir}}{{.HumanSize}}{{end}}</td><td>{{.ModTime.Format "2006-01-02 15:04:05"}}</td></tr>
+{{- end}}
+	</table>
+	<span style="position: absolute; bottom: 10px; right: 10px;">Static Server {{.Version}}</span>
+</body>
+</html>`))
+
+func (h *staticHandler) serveListing(w http.ResponseWriter, r *http.Request, dir *os.File) {
+	infos, err := dir.Readdir(-1)
+	if err != nil {
+		httpError(w, r, http.StatusInternalServerError, "Error reading directory")
+		return
+	}
+
+	entries := make([]listingEntry, 0, len(infos))
+	for _, info := range infos {
+		if !h.dotfiles && strings.HasPrefix(info.Name(), ".") {
+			continue
+		}
+		if !info.IsDir() && hasBlockedExt(h.blockedExts, info.Name()) {
+			continue
+		}
+
+		href := (&url.URL{Path: "./" + info.Name()}).String()
+		if info.IsDir() {
+			href += "/"
+		}
+		entries = append(entries, listingEntry{
+			Name:      info.Name(),
+			URL:       href,
+			Size:      info.Size(),
+			HumanSize: formatBytes(uint64(info.Size())),
+			ModTime:   info.ModTime(),
+			IsDir:     info.IsDir(),
+		})
+	}
+
+	sortBy, order := r.URL.Query().Get("sort"), r.URL.Query().Get("order")
+	switch sortBy {
+	case "size", "time":
+	default:
+		sortBy = "name"
+	}
+	if order != "desc" {
+		order = "asc"
+	}
+	sortListing(entries, sortBy, order == "desc")
+
+	displayPath := "/" + r.URL.Path
+	if u, err := url.ParseRequestURI(r.RequestURI); err == nil {
+		displayPath = u.Path
+	}
+
+	tmpl := h.listingTemplate
+	if tmpl == nil {
+		tmpl = defaultListingTemplate
+	}
+
+	var buf bytes.Buffer
+	page := listingPage{
+		Path:        displayPath,
+		Entries:     entries,
+		Version:     serVer,
+		Sort:        sortBy,
+		Order:       order,
+		NameSortURL: listingSortURL("name", sortBy, order),
+		SizeSortURL: listingSortURL("size", sortBy, order),
+		TimeSortURL: listingSortURL("time", sortBy, order),
+	}
+	if err := tmpl.Execute(&buf, page); err != nil {
+		log.Printf("Error rendering directory listing: %v", err)
+		httpError(w, r, http.StatusInternalServerError, "Error rendering directory listing")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if h.liveReload {
+		w.Write(injectLiveReload(buf.Bytes()))
+		return
+	}
+	w.Write(buf.Bytes())
+}
+
+// sortListing orders entries by name, size or time, keeping directories
+// ahead of files whichever way the entries are sorted.
+func sortListing(entries []listingEntry, sortBy string, desc bool) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.IsDir != b.IsDir {
+			return a.IsDir
+		}
+
+		var less, greater bool
+		switch sortBy {
+		case "size":
+			less, greater = a.Size < b.Size, a.Size > b.Size
+		case "time":
+			less, greater = a.ModTime.Before(b.ModTime), a.ModTime.After(b.ModTime)
+		}
+		if !less && !greater {
+			less, greater = a.Name < b.Name, a.Name > b.Name
+		}
+		if desc {
+			return greater
+		}
+		return less
+	})
+}
+
+func listingSortURL(column, sortBy, order string) string {
+	next := "asc"
+	if column == sortBy && order == "asc" {
+		next = "desc"
+	}
+	return "?sort=" + column + "&order=" + next
+}
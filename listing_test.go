@@ -0,0 +1,88 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestListingEscapesFileNames(t *testing.T) {
+	dir, h := newTestSite(t)
+	h.dev = true
+	tricky := `<img src=x onerror=alert(1)>"onmouseover=x.txt`
+	writeTestFile(t, filepath.Join(dir, "files", tricky), "x")
+
+	rec := serveRaw(h, "/files/", nil)
+	body := rec.Body.String()
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /files/ = %d", rec.Code)
+	}
+	if strings.Contains(body, "<img") || strings.Contains(body, `"onmouseover`) {
+		t.Errorf("listing contains the file name unescaped:\n%s", body)
+	}
+	if !strings.Contains(body, "&lt;img src=x onerror=alert(1)&gt;&#34;onmouseover=x.txt") {
+		t.Errorf("listing lacks the escaped file name:\n%s", body)
+	}
+}
+
+func TestListingTemplate(t *testing.T) {
+	dir, h := newTestSite(t)
+	h.dev = true
+	writeTestFile(t, filepath.Join(dir, "files", "<b>.txt"), "12345")
+	writeTestFile(t, filepath.Join(dir, "files", "inner", "c.txt"), "x")
+	h.listingTemplate = template.Must(template.New("custom").Parse(
+		`{{range .Entries}}[{{.Name}} {{.IsDir}} {{not .ModTime.IsZero}}{{if not .IsDir}} {{.Size}}{{end}}]{{end}}`))
+
+	rec := serveRaw(h, "/files/", nil)
+	if want := "[inner true true][&lt;b&gt;.txt false true 5]"; rec.Body.String() != want {
+		t.Errorf("custom listing = %q, want %q", rec.Body.String(), want)
+	}
+}
+
+func TestListingSort(t *testing.T) {
+	dir, h := newTestSite(t)
+	h.dev = true
+	base := time.Now().Add(-time.Hour)
+	for i, f := range []struct{ name, body string }{
+		{"b.txt", "1"},
+		{"c.txt", "333"},
+		{"a.txt", "22"},
+	} {
+		path := filepath.Join(dir, "files", f.name)
+		writeTestFile(t, path, f.body)
+		mtime := base.Add(time.Duration(i) * time.Minute)
+		os.Chtimes(path, mtime, mtime)
+	}
+	writeTestFile(t, filepath.Join(dir, "files", "zdir", "x.txt"), "x")
+	writeTestFile(t, filepath.Join(dir, "files", "adir", "x.txt"), "x")
+	os.Chtimes(filepath.Join(dir, "files", "zdir"), base, base)
+	os.Chtimes(filepath.Join(dir, "files", "adir"), base.Add(time.Hour), base.Add(time.Hour))
+	h.listingTemplate = template.Must(template.New("sort").Parse(
+		`{{.Sort}} {{.Order}}:{{range .Entries}} {{.Name}}{{end}} |{{.NameSortURL}}|{{.SizeSortURL}}|{{.TimeSortURL}}`))
+
+	for _, c := range []struct {
+		query string
+		want  string
+	}{
+		{"", "name asc: adir zdir a.txt b.txt c.txt |?sort=name&amp;order=desc|?sort=size&amp;order=asc|?sort=time&amp;order=asc"},
+		{"?sort=name&order=desc", "name desc: zdir adir c.txt b.txt a.txt |?sort=name&amp;order=asc|?sort=size&amp;order=asc|?sort=time&amp;order=asc"},
+		{"?sort=size", "size asc: adir zdir b.txt a.txt c.txt |?sort=name&amp;order=asc|?sort=size&amp;order=desc|?sort=time&amp;order=asc"},
+		{"?sort=size&order=desc", "size desc: zdir adir c.txt a.txt b.txt |?sort=name&amp;order=asc|?sort=size&amp;order=asc|?sort=time&amp;order=asc"},
+		{"?sort=time&order=asc", "time asc: zdir adir b.txt c.txt a.txt |?sort=name&amp;order=asc|?sort=size&amp;order=asc|?sort=time&amp;order=desc"},
+		{"?sort=time&order=desc", "time desc: adir zdir a.txt c.txt b.txt |?sort=name&amp;order=asc|?sort=size&amp;order=asc|?sort=time&amp;order=asc"},
+		{"?sort=bogus&order=sideways", "name asc: adir zdir a.txt b.txt c.txt |?sort=name&amp;order=desc|?sort=size&amp;order=asc|?sort=time&amp;order=asc"},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/"+c.query, nil)
+		req.URL.Path = "/files/"
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if got := rec.Body.String(); got != c.want {
+			t.Errorf("listing%s = %q, want %q", c.query, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"sync"
+
+	"golang.org/x/net/websocket"
+)
+
+const liveReloadPath = "/livereload"
+
+const liveReloadScript = `<script>(function(){var s=location.protocol==="https:"?"wss:":"ws:";var ws=new WebSocket(s+"//"+location.host+"` + liveReloadPath + `");ws.onmessage=function(){location.reload();};})();</script>`
+
+// liveReload tells every connected page to reload when a watched file
+// changes. Each client gets a buffered channel so that a burst of events
+// from a single save collapses into one reload.
+type liveReload struct {
+	mu      sync.Mutex
+	clients map[chan struct{}]struct{}
+}
+
+func newLiveReload() *liveReload {
+	return &liveReload{clients: map[chan struct{}]struct{}{}}
+}
+
+func (l *liveReload) broadcast() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for c := range l.clients {
+		select {
+		case c <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (l *liveReload) subscribe() chan struct{} {
+	c := make(chan struct{}, 1)
+	l.mu.Lock()
+	l.clients[c] = struct{}{}
+	l.mu.Unlock()
+	return c
+}
+
+func (l *liveReload) unsubscribe(c chan struct{}) {
+	l.mu.Lock()
+	delete(l.clients, c)
+	l.mu.Unlock()
+}
+
+func (l *liveReload) handler() websocket.Handler {
+	return func(ws *websocket.Conn) {
+		defer ws.Close()
+
+		c := l.subscribe()
+		defer l.unsubscribe(c)
+
+		closed := make(chan struct{})
+		go func() {
+			var msg string
+			for websocket.Message.Receive(ws, &msg) == nil {
+			}
+			close(closed)
+		}()
+
+		for {
+			select {
+			case <-c:
+				if err := websocket.Message.Send(ws, "reload"); err != nil {
+					return
+				}
+			case <-closed:
+				return
+			}
+		}
+	}
+}
+
+func injectLiveReload(body []byte) []byte {
+	i := bytes.LastIndex(bytes.ToLower(body), []byte("</body>"))
+	if i < 0 {
+		return append(body, liveReloadScript...)
+	}
+
+	out := make([]byte, 0, len(body)+len(liveReloadScript))
+	out = append(out, body[:i]...)
+	out = append(out, liveReloadScript...)
+	return append(out, body[i:]...)
+}
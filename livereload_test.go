@@ -0,0 +1,82 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+func TestInjectLiveReload(t *testing.T) {
+	cases := []struct {
+		body, want string
+	}{
+		{"<html><body><p>hi</p></body></html>", "<html><body><p>hi</p>" + liveReloadScript + "</body></html>"},
+		{"<BODY>upper</BODY>", "<BODY>upper" + liveReloadScript + "</BODY>"},
+		{"<p>fragment</p>", "<p>fragment</p>" + liveReloadScript},
+	}
+	for _, c := range cases {
+		if got := string(injectLiveReload([]byte(c.body))); got != c.want {
+			t.Errorf("injectLiveReload(%q) = %q, want %q", c.body, got, c.want)
+		}
+	}
+}
+
+func TestLiveReloadInjectsOnlyHTML(t *testing.T) {
+	dir, h := newTestSite(t)
+	writeTestFile(t, filepath.Join(dir, "page.html"), "<body>page</body>")
+	h.dev = true
+
+	for _, enabled := range []bool{false, true} {
+		h.liveReload = enabled
+		for _, urlPath := range []string{"/page.html", "/a.txt"} {
+			body := serveRaw(h, urlPath, nil).Body.String()
+			injected := strings.Contains(body, liveReloadScript)
+			if want := enabled && urlPath == "/page.html"; injected != want {
+				t.Errorf("--livereload=%v: GET %s injected %v, want %v", enabled, urlPath, injected, want)
+			}
+		}
+	}
+}
+
+func TestLiveReloadRequiresDev(t *testing.T) {
+	out, err := runMain(t, "--directory", t.TempDir(), "--livereload")
+	if err == nil || !strings.Contains(out, "--livereload requires --dev") {
+		t.Errorf("--livereload without --dev: err %v, output %q", err, out)
+	}
+}
+
+func TestLiveReloadBroadcastsChanges(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "index.html"), "<body>index</body>")
+	addr, _, _ := startServer(t, "--directory", dir, "--dev", "--livereload")
+
+	resp, err := http.Get("http://" + addr + "/static/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(page), liveReloadScript) {
+		t.Errorf("served page lacks the live reload script: %q", page)
+	}
+
+	ws, err := websocket.Dial("ws://"+addr+liveReloadPath, "", "http://"+addr+"/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	// Wait for the server to register the client before changing a file.
+	time.Sleep(100 * time.Millisecond)
+	writeTestFile(t, filepath.Join(dir, "index.html"), "<body>changed</body>")
+
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var msg string
+	if err := websocket.Message.Receive(ws, &msg); err != nil || msg != "reload" {
+		t.Errorf("websocket got %q (err %v), want \"reload\" after a file changed", msg, err)
+	}
+}
@@ -1,188 +1,674 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
-	"io"
+	"html/template"
 	"log"
+	"math"
+	"mime"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"runtime"
-	"sync"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
 
-	"github.com/gorilla/mux"
+	"github.com/fsnotify/fsnotify"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 const serVer = "v1.0.0"
 
 var startTime time.Time
-var requestTimestamps = struct {
-	sync.Mutex
-	timestamps []time.Time
-}{}
+var ready atomic.Bool
+var requestCounts = newRequestCounter(60 * time.Second)
+var pathCounts = newPathCounter(60 * time.Second)
+
+// statsExclude lists the paths, from --stats-exclude, that are left out of
+// requestCounts and pathCounts. Each entry also covers the paths below it.
+var statsExclude []string
 
 func main() {
 	helpBool := flag.Bool("help", false, "display help")
+	configFile := flag.String("config", "", "JSON file with default flag values")
+	checkOnly := flag.Bool("check", false, "validate the configuration and exit without serving")
+	host := flag.String("host", "", "address to bind to (default: all interfaces)")
 	port := flag.String("port", "3456", "port to listen on")
 	staticFileDir := flag.String("directory", "./web", "directory from which static files are served")
+	embedded := flag.Bool("embedded", false, "serve the site compiled into the binary (built with -tags embedsite) instead of --directory")
+	staticPrefix := flag.String("prefix", "/static/", "URL path the static directory is served under")
+	maintenanceFlag := flag.Bool("maintenance", false, "start in maintenance mode; SIGUSR1 toggles it")
+	onDirLost := flag.String("on-dir-lost", "retry", "what to do when --directory disappears while serving: retry or exit")
+	noCreateDir := flag.Bool("no-create-dir", false, "exit with an error instead of creating a missing --directory")
 	slidingWindowDuration := flag.Duration("statswindow", 60*time.Second, "duration for calculating request statistics")
+	statsExcludeSpec := flag.String("stats-exclude", "/stats,/healthz,/metrics", "comma-separated paths left out of the request statistics")
+	statsTopN := flag.Int("stats-top-n", 10, "number of paths listed by /stats/files")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 10*time.Second, "grace period for in-flight requests on shutdown")
+	readTimeout := flag.Duration("read-timeout", 15*time.Second, "maximum time to read a request, including headers")
+	writeTimeout := flag.Duration("write-timeout", 0, "maximum time to write a response (0 disables)")
+	idleTimeout := flag.Duration("idle-timeout", 60*time.Second, "how long idle keep-alive connections stay open")
+	maxHeaderSize := flag.Int("max-header-size", 64<<10, "maximum size of request headers in bytes")
+	bufferSize := flag.Int64("buffer-size", 0, "files up to this many bytes are read into memory and sent in one write (0 disables)")
+	maxBandwidth := flag.Int64("max-bandwidth", 0, "total bytes per second served from the static directory across all clients (0 disables)")
+	maxFileSize := flag.Int64("max-file-size", 0, "largest file in bytes that will be served (0 disables)")
+	maxRequestSize := flag.Int64("max-request-size", 1<<20, "maximum request body size in bytes")
+	socketPath := flag.String("socket", "", "listen on a Unix domain socket instead of a TCP port")
+	listenFD := flag.Int("listen-fd", 0, "serve on an inherited listening socket with this file descriptor number")
+	h2cEnabled := flag.Bool("h2c", false, "accept HTTP/2 over cleartext connections")
+	certFile := flag.String("cert", "", "TLS certificate file")
+	keyFile := flag.String("key", "", "TLS private key file")
+	autocertDomains := flag.String("autocert-domains", "", "comma-separated domains to obtain Let's Encrypt certificates for")
+	autocertCache := flag.String("autocert-cache", "./certs", "directory where Let's Encrypt certificates are cached")
+	redirectHTTP := flag.Bool("redirect-http", false, "redirect plain HTTP requests on --redirect-port to HTTPS")
+	redirectPort := flag.String("redirect-port", "80", "port for the HTTP to HTTPS redirect listener")
+	strictSlash := flag.Bool("strict-slash", true, "redirect between /path and /path/ for the built-in routes")
+	indexFile := flag.String("index", "index.html", "file served for directory requests")
+	adminToken := flag.String("admin-token", "", "bearer token that enables POST /stats/reset")
+	metricsEnabled := flag.Bool("metrics", true, "expose Prometheus metrics at /metrics")
+	metricsExemplars := flag.Bool("metrics-exemplars", false, "attach request and trace IDs to /metrics latency buckets as OpenMetrics exemplars")
+	logFile := flag.String("logfile", "", "file to append access logs to")
+	logFormat := flag.String("logformat", "text", "access log format: text, common or json")
+	quiet := flag.Bool("quiet", false, "suppress per-request access logs and the startup summary")
+	verbose := flag.Bool("verbose", false, "also log requests for /, /favicon.ico, health probes and client disconnects")
+	authSpec := flag.String("auth", "", "protect static files with basic auth (user:pass or htpasswd file)")
+	etagMode := flag.String("etag-mode", "mtime", "how ETags are computed: mtime, hash or off")
+	emitExpires := flag.Bool("emit-expires", false, "send an Expires header matching each Cache-Control max-age")
+	cacheControlSpec := flag.String("cache-control", "", "Cache-Control max-age overrides per extension, e.g. css=86400,html=0")
+	hideVersion := flag.Bool("hide-version", false, "leave out the Server header that names the server version")
+	securityHeaders := flag.Bool("security-headers", true, "send X-Content-Type-Options, X-Frame-Options and Referrer-Policy headers")
+	csp := flag.String("csp", "", "Content-Security-Policy header value")
+	corsOrigins := flag.String("cors-origins", "", "comma-separated origins allowed for CORS, or * for any")
+	var headers headerList
+	flag.Var(&headers, "header", "extra response header for paths matching a glob, as pathglob:Header-Name:value (repeatable)")
+	compression := flag.String("compression", "auto", "response compression: auto, gzip, br or none")
+	flag.Bool("no-favicon-download", false, "deprecated: leave --favicon-url empty to skip the download")
+	noFavicon := flag.Bool("no-favicon", false, "do not serve /favicon.ico or download one")
+	downloadTimeout := flag.Duration("download-timeout", 10*time.Second, "total time allowed for fetching --favicon-url and other assets at startup")
+	faviconURL := flag.String("favicon-url", "", "URL to download favicon.ico from when the static directory has none")
+	mimeTypes := flag.String("mime", "", "extra MIME types per extension, e.g. webmanifest=application/manifest+json")
+	defaultContentType := flag.String("default-content-type", "", "Content-Type for files whose extension has no known MIME type")
+	noSniff := flag.Bool("no-sniff", false, "derive Content-Type from the file extension only, never from the file contents")
+	noCompressExt := flag.String("no-compress-ext", defaultNoCompressExts, "comma-separated extensions of already-compressed files that are never compressed again")
+	compressMinSize := flag.Int64("compress-min-size", 1024, "smallest response in bytes worth compressing")
+	var mounts mountList
+	flag.Var(&mounts, "mount", "serve an extra directory under a prefix, as /prefix=/path (repeatable)")
+	devMode := flag.Bool("dev", false, "development mode: directory listings and no caching")
+	liveReloadEnabled := flag.Bool("livereload", false, "reload open pages when files change (requires --dev)")
+	watch := flag.Bool("watch", false, "log files created, modified or deleted in the static directory")
+	openFlag := flag.Bool("open", false, "open the default browser once the server is listening")
+	rootFile := flag.String("root-file", "", "file served at / instead of the built-in page")
+	templateMode := flag.Bool("template", false, "render .html files through html/template with include and buildTime helpers")
+	listingTemplate := flag.String("listing-template", "", "html/template file used to render directory listings in --dev mode")
+	followSymlinks := flag.Bool("follow-symlinks", false, "serve symlinks that point outside the static directory")
+	serveDotfiles := flag.Bool("serve-dotfiles", false, "serve files and directories whose names start with a dot")
+	blockExt := flag.String("block-ext", "", "comma-separated file extensions that are never served, e.g. go,env,conf")
+	spaMode := flag.Bool("spa", false, "serve the root index file for unknown routes without a file extension")
+	trustProxyHeaders := flag.Bool("trust-proxy", false, "take the client IP from X-Forwarded-For or X-Real-IP")
+	allowCIDRs := flag.String("allow", "", "comma-separated CIDRs allowed to connect")
+	denyCIDRs := flag.String("deny", "", "comma-separated CIDRs refused with 403")
+	defaultPolicy := flag.String("default-policy", "allow", "policy for clients matching neither --allow nor --deny: allow or deny")
+	fallbackOrigin := flag.String("fallback-origin", "", "upstream URL to proxy requests for files missing from the static directory")
+	fallbackCache := flag.Bool("fallback-cache", false, "save files fetched from --fallback-origin into the static directory")
+	maxConcurrent := flag.Int("max-concurrent", 0, "maximum number of requests served at once (0 disables)")
+	queueTimeout := flag.Duration("queue-timeout", 5*time.Second, "how long a request waits for a --max-concurrent slot before a 503")
+	rateLimit := flag.Float64("ratelimit", 0, "requests per second allowed per client IP (0 disables)")
+	rateBurst := flag.Int("burst", 0, "burst size for --ratelimit (default: the rate, at least 1)")
 
 	flag.Parse()
 
+	if *configFile != "" {
+		if err := loadConfigFile(*configFile); err != nil {
+			log.Fatalf("Error loading config file: %v", err)
+		}
+	}
+
 	if *helpBool {
 		fmt.Println("Static Server " + serVer)
 		fmt.Println("")
 		fmt.Println("Usage:")
-		fmt.Println("--help        display help")
-		fmt.Println("--port        specify the port to listen on (default: " + *port + ")")
-		fmt.Println("--directory   specify the directory from which static files are served (default: ./web)")
-		fmt.Println("--statswindow specify the duration for calculating request statistics (default: 60 seconds)")
+		fmt.Println("--help                  display help")
+		fmt.Println("--config                specify a JSON file whose keys mirror these flags; flags given on the command line take precedence")
+		fmt.Println("--check                 validate the directory, TLS files, listen address and config, then exit")
+		fmt.Println("--host                  specify the address to bind to, e.g. 127.0.0.1 for local-only serving (default: all interfaces)")
+		fmt.Println("--port                  specify the port to listen on (default: " + *port + ")")
+		fmt.Println("--directory             specify the directory from which static files are served (default: ./web)")
+		fmt.Println("--embedded              serve the files compiled into the binary instead of --directory; build with 'go build -tags embedsite' after copying the site into ./site (default: false)")
+		fmt.Println("--prefix                specify the URL path --directory is served under; / serves files at the root, behind the built-in endpoints (default: /static/)")
+		fmt.Println("--maintenance           start in maintenance mode, answering all but /healthz and /readyz with 503 and maintenance.html from --directory; SIGUSR1 toggles it, and it is also on while a .maintenance file exists there (default: false)")
+		fmt.Println("--on-dir-lost           specify what happens when --directory disappears, e.g. an unmounted volume: retry fails /readyz until it is back, exit quits with status 1 (default: retry)")
+		fmt.Println("--no-create-dir         exit with an error when --directory or a --mount directory is missing instead of creating it empty (default: false)")
+		fmt.Println("--statswindow           specify the duration for calculating request statistics (default: 60 seconds)")
+		fmt.Println("--stats-exclude         specify comma-separated paths, and everything below them, left out of /stats request counts; /favicon.ico never counts (default: /stats,/healthz,/metrics)")
+		fmt.Println("--stats-top-n           specify how many of the most requested paths /stats/files lists (default: 10)")
+		fmt.Println("--shutdown-timeout      specify how long to wait for in-flight requests on shutdown (default: 10 seconds)")
+		fmt.Println("--socket                specify a Unix domain socket path to listen on instead of --port")
+		fmt.Println("--listen-fd             specify an inherited listening socket to serve on, e.g. 3; systemd socket activation via LISTEN_FDS is detected without it (default: 0, open a new socket)")
+		fmt.Println("--read-timeout          specify the maximum time to read a request including headers, which cuts off slow clients (default: 15 seconds)")
+		fmt.Println("--write-timeout         specify the maximum time to write a response; large downloads on slow links need it disabled (default: 0, disabled)")
+		fmt.Println("--idle-timeout          specify how long idle keep-alive connections are kept open (default: 60 seconds)")
+		fmt.Println("--max-header-size       specify the maximum size of request headers in bytes (default: 65536)")
+		fmt.Println("--buffer-size           specify the size in bytes up to which files are read into memory and sent in a single write, e.g. 16384 (default: 0, always stream)")
+		fmt.Println("--max-bandwidth         specify the total bytes per second file downloads may use, shared by all clients, e.g. 1048576 (default: 0, unlimited)")
+		fmt.Println("--max-file-size         specify the largest file in bytes that will be served; bigger files get HTTP 403 (default: 0, no limit)")
+		fmt.Println("--max-request-size      specify the maximum request body size in bytes; larger requests get HTTP 413 (default: 1048576)")
+		fmt.Println("--h2c                   accept HTTP/2 over cleartext (h2c) alongside HTTP/1.1; TLS connections negotiate HTTP/2 on their own (default: false)")
+		fmt.Println("--cert                  specify the TLS certificate file (requires --key)")
+		fmt.Println("--key                   specify the TLS private key file (requires --cert)")
+		fmt.Println("--autocert-domains      obtain and renew Let's Encrypt certificates for these comma-separated domains; serves HTTPS on 443 and the ACME challenge on 80")
+		fmt.Println("--autocert-cache        specify the directory where Let's Encrypt certificates are cached (default: ./certs)")
+		fmt.Println("--redirect-http         listen for plain HTTP on --redirect-port and redirect it to HTTPS (requires --cert and --key)")
+		fmt.Println("--redirect-port         specify the port for the HTTP to HTTPS redirect listener (default: 80)")
+		fmt.Println("--strict-slash          redirect /path/ to /path (and back) for built-in routes such as /stats; directory index redirects under /static/ happen either way (default: true)")
+		fmt.Println("--index                 specify the file served for directory requests (default: index.html)")
+		fmt.Println("--etag-mode             specify how ETags are computed: mtime from the modification time and size, hash from a SHA-256 of the contents, or off (default: mtime)")
+		fmt.Println("--emit-expires          send an absolute Expires header alongside Cache-Control for proxies that ignore max-age (default: false)")
+		fmt.Println("--cache-control         override Cache-Control max-age seconds per extension, e.g. css=86400,html=0 (default: images/fonts 1 year, html no-cache)")
+		fmt.Println("--hide-version          do not send the Server: Static-Server/" + serVer + " header; X-Uptime-Seconds is still sent (default: false)")
+		fmt.Println("--security-headers      send nosniff, frame-deny and no-referrer security headers (default: true, disable with --security-headers=false)")
+		fmt.Println("--csp                   specify a Content-Security-Policy header to send with security headers")
+		fmt.Println("--cors-origins          specify comma-separated origins allowed to make CORS requests, or * for any (default: none)")
+		fmt.Println("--header                add a response header to paths matching a glob, e.g. '/static/*.wasm:Cross-Origin-Embedder-Policy:require-corp' (repeatable)")
+		fmt.Println("--compression           specify response compression: auto (brotli, then gzip), gzip, br or none (default: auto)")
+		fmt.Println("--mime                  register extra MIME types as comma-separated ext=type pairs, e.g. webmanifest=application/manifest+json")
+		fmt.Println("--default-content-type  specify the Content-Type for files with an unknown or no extension, e.g. 'text/plain; charset=utf-8' (default: sniffed from the contents)")
+		fmt.Println("--no-sniff              send X-Content-Type-Options: nosniff and take Content-Type from the extension alone; unknown extensions get application/octet-stream (default: false)")
+		fmt.Println("--no-compress-ext       specify comma-separated extensions of already-compressed files that are sent as-is, replacing the default list (default: gz,br,zip,svgz,png,jpg,webp,woff2 and other archive, image, font and media types)")
+		fmt.Println("--compress-min-size     specify the smallest file size in bytes that gets compressed (default: 1024)")
+		fmt.Println("--mount                 serve an extra directory under its own prefix, as /prefix=/path (repeatable)")
+		fmt.Println("--dev                   enable development mode: directory listings, Cache-Control: no-store and no ETags (default: false)")
+		fmt.Println("--livereload            inject a script into HTML pages that reloads them whenever a file in --directory changes (requires --dev)")
+		fmt.Println("--watch                 log files created, modified or deleted anywhere in --directory, to confirm edits are live (default: false)")
+		fmt.Println("--open                  open the default browser at the server address once it is listening; only when run from a terminal (default: false)")
+		fmt.Println("--favicon-url           specify an http(s) URL to download favicon.ico from at startup when --directory has none (default: empty, use the built-in one)")
+		fmt.Println("--download-timeout      specify the total time startup waits for assets such as --favicon-url, fetched concurrently with retries (default: 10 seconds)")
+		fmt.Println("--no-favicon            do not register the /favicon.ico endpoint or download a favicon, e.g. when a CDN serves it (default: false)")
+		fmt.Println("--root-file             specify a file to serve at / instead of the built-in page")
+		fmt.Println("--template              render .html files as html/template; {{include \"header.html\"}} inserts another file and {{buildTime}} the server start time (default: false)")
+		fmt.Println("--listing-template      specify an html/template file for --dev directory listings; it receives .Path, .Version and .Entries (Name, URL, Size, ModTime, IsDir)")
+		fmt.Println("--follow-symlinks       serve symlinks that resolve outside the served directory; by default they get HTTP 403 (default: false)")
+		fmt.Println("--block-ext             refuse with HTTP 403 any file with one of these comma-separated extensions, e.g. go,env,conf (default: empty)")
+		fmt.Println("--serve-dotfiles        serve paths with components starting with a dot, such as .env or .git/config (default: false)")
+		fmt.Println("--spa                   serve the root index file for unknown routes so client-side routing works (default: false)")
+		fmt.Println("--admin-token           enable POST /stats/reset for clients sending Authorization: Bearer <token> (default: empty, disabled)")
+		fmt.Println("--metrics               enable the Prometheus /metrics endpoint (default: true, disable with --metrics=false)")
+		fmt.Println("--metrics-exemplars     attach the latest request or trace ID to each /metrics latency bucket; only sent to scrapers that accept OpenMetrics (default: false)")
+		fmt.Println("--logfile               specify a file to append access logs to (default: stderr); reopened on SIGHUP for log rotation")
+		fmt.Println("--logformat             specify the access log format: text, common or json ; each line ends with the total duration, time to first byte and request ID (default: text)")
+		fmt.Println("--quiet                 suppress per-request access logs and the startup summary, keeping errors")
+		fmt.Println("--verbose               also log requests for /, /favicon.ico and the health probes, plus client disconnects during downloads")
+		fmt.Println("--auth                  protect static files, /integrity, /sitemap.xml and /stats/files with HTTP basic auth, as user:pass or a path to an htpasswd file")
+		fmt.Println("--trust-proxy           take the client IP for logs, --ratelimit and --allow/--deny from X-Forwarded-For or X-Real-IP; only use behind a proxy that sets them (default: false)")
+		fmt.Println("--allow                 specify comma-separated CIDRs or addresses that may connect, e.g. 10.0.0.0/8,192.168.1.5")
+		fmt.Println("--deny                  specify comma-separated CIDRs or addresses refused with HTTP 403; deny wins over --allow")
+		fmt.Println("--default-policy        specify what happens to clients matching neither list: allow or deny (default: allow)")
+		fmt.Println("--fallback-origin       specify an upstream URL that missing static files are proxied from instead of returning 404, e.g. https://origin.example.com/static")
+		fmt.Println("--fallback-cache        save files fetched from --fallback-origin into the served directory so later requests are served locally (default: false)")
+		fmt.Println("--max-concurrent        specify how many requests are served at once; further requests wait for a free slot (default: 0, unlimited)")
+		fmt.Println("--queue-timeout         specify how long a request waits for a --max-concurrent slot before getting HTTP 503 (default: 5 seconds)")
+		fmt.Println("--ratelimit             specify the requests per second allowed per client IP (default: 0, disabled)")
+		fmt.Println("--burst                 specify how many requests a client may burst above --ratelimit (default: the rate, at least 1)")
 		fmt.Println("")
 		fmt.Println("Description:")
-		fmt.Println(" Static Server is an HTTP server designed to serve static files efficiently. Static Server has directory listing turned off by default.")
+		fmt.Println(" Static Server is an HTTP server designed to serve static files efficiently. Static Server has directory listing turned off by default; --dev turns it on.")
+		fmt.Println(" Directory requests are answered with the directory's index file when one exists.")
+		fmt.Println(" Static files carry ETag and Last-Modified headers, so If-None-Match, If-Modified-Since and Range requests are honored.")
+		fmt.Println(" Multi-range requests get a multipart/byteranges response. Range requests are always served from the uncompressed file.")
+		fmt.Println(" A file replaced by rename while it is downloading keeps serving its old contents; one rewritten in place may send a mix of")
+		fmt.Println(" old and new bytes, so clients resuming a download should send If-Range with the ETag they started with.")
 		fmt.Println("")
 		fmt.Println("Usage Examples:")
 		fmt.Println(" Run the server with default settings:")
 		fmt.Println("    $ ./static-server")
 		fmt.Println(" Run the server on a different port:")
 		fmt.Println("    $ ./static-server --port 8080")
+		fmt.Println(" Only accept connections from this machine:")
+		fmt.Println("    $ ./static-server --host 127.0.0.1")
 		fmt.Println(" Serve static files from a different directory:")
 		fmt.Println("    $ ./static-server --directory /path/to/static/files")
 		fmt.Println(" Change the duration for calculating request statistics:")
 		fmt.Println("    $ ./static-server --statswindow 120s")
+		fmt.Println(" Password-protect the static files:")
+		fmt.Println("    $ ./static-server --auth admin:secret")
+		fmt.Println(" Load settings from a config file:")
+		fmt.Println("    $ ./static-server --config /etc/static-server.json")
+		fmt.Println(" Serve several directories from one server:")
+		fmt.Println("    $ ./static-server --mount /docs=/srv/docs --mount /blog=/srv/blog")
+		fmt.Println(" Listen on a Unix domain socket behind a reverse proxy:")
+		fmt.Println("    $ ./static-server --socket /run/static-server.sock")
+		fmt.Println(" Validate a configuration before deploying:")
+		fmt.Println("    $ ./static-server --config /etc/static-server.json --check")
+		fmt.Println(" Serve over HTTPS:")
+		fmt.Println("    $ ./static-server --cert cert.pem --key key.pem")
+		fmt.Println(" Serve over HTTPS with certificates from Let's Encrypt:")
+		fmt.Println("    $ ./static-server --autocert-domains example.com,www.example.com")
 		fmt.Println("")
 		fmt.Println("Endpoints:")
-		fmt.Println(" - /: Serves the 'it works' page.")
-		fmt.Println(" - /stats: Provides server statistics in JSON format.")
-		fmt.Println(" - /favicon.ico: Serves the favicon.")
-		fmt.Println(" - /static/: Serves static files from the specified static directory. Default: " + *staticFileDir)
+		fmt.Println(" - /: Serves the 'it works' page, or the --root-file when set.")
+		fmt.Println(" - /stats: Provides server statistics in JSON format; add ?pretty=true for indented output.")
+		fmt.Println(" - /stats/reset: POST with the --admin-token to zero the request counters and metrics.")
+		fmt.Println(" - /stats/files: Lists the most requested paths within the stats window in JSON format.")
+		fmt.Println(" - /integrity?path=/static/app.js: Returns the sha256 subresource integrity hash of a static file in JSON format.")
+		fmt.Println(" - /sitemap.xml: Lists every file in the static directory as a sitemap, with absolute URLs for the requesting host.")
+		fmt.Println(" - /metrics: Provides server metrics in Prometheus text format.")
+		fmt.Println(" - /livereload: WebSocket that tells pages to reload, with --livereload.")
+		fmt.Println(" - /healthz: Liveness probe, always returns 'ok'. Neither probe is subject to --allow/--deny, --ratelimit or --max-concurrent.")
+		fmt.Println(" - /readyz: Readiness probe, returns 'ok' once startup has finished.")
+		fmt.Println(" - /favicon.ico: Serves favicon.ico from the static directory, or the built-in one, unless --no-favicon is set.")
+		fmt.Println(" - " + *staticPrefix + ": Serves static files from the specified static directory. Default: " + *staticFileDir)
 		fmt.Println("")
 		fmt.Println("Note:")
 		fmt.Println(" The server listens on port " + *port + " by default.")
+		fmt.Println(" Only GET and HEAD requests are answered, plus OPTIONS preflights when --cors-origins is set; anything else gets HTTP 405.")
 		return
 	}
 
-	initFolders(*staticFileDir)
+	if (*certFile == "") != (*keyFile == "") {
+		log.Fatalf("Error: --cert and --key must be provided together to enable TLS")
+	}
+	if *autocertDomains != "" && *certFile != "" {
+		log.Fatalf("Error: --autocert-domains cannot be combined with --cert and --key")
+	}
+	tlsEnabled := *certFile != "" || *autocertDomains != ""
+	if *h2cEnabled && tlsEnabled {
+		log.Fatalf("Error: --h2c is for cleartext connections and cannot be combined with TLS")
+	}
+	if *embedded && embeddedSite == nil {
+		log.Fatalf("Error: --embedded requires a binary built with -tags embedsite")
+	}
+	if *embedded && siteIsEmpty(embeddedSite) {
+		log.Fatalf("Error: --embedded: the site directory was empty when this binary was built; copy the site into ./site and rebuild with -tags embedsite")
+	}
+	if *liveReloadEnabled && !*devMode {
+		log.Fatalf("Error: --livereload requires --dev")
+	}
+	if *quiet && *verbose {
+		log.Fatalf("Error: --quiet and --verbose cannot be used together")
+	}
+	if *downloadTimeout <= 0 {
+		log.Fatalf("Error: --download-timeout must be positive")
+	}
+	if *maxBandwidth < 0 {
+		log.Fatalf("Error: --max-bandwidth cannot be negative")
+	}
+	if *listenFD < 0 {
+		log.Fatalf("Error: --listen-fd must be a file descriptor number")
+	}
+	if *listenFD > 0 && *socketPath != "" {
+		log.Fatalf("Error: --listen-fd and --socket cannot be used together")
+	}
+	if *redirectHTTP && !tlsEnabled {
+		log.Fatalf("Error: --redirect-http requires TLS to be enabled with --cert and --key")
+	}
 
-	faviconPath := filepath.Join(*staticFileDir, "favicon.ico")
-	if _, err := os.Stat(faviconPath); errors.Is(err, os.ErrNotExist) {
-		resp, err := http.Get("https://raw.githubusercontent.com/donuts-are-good/static/master/favicon.ico")
-		if err != nil {
-			log.Fatalf("Error downloading favicon: %v", err)
-		}
-		defer resp.Body.Close()
+	if err := validCompressionMode(*compression); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
 
-		out, err := os.Create(faviconPath)
-		if err != nil {
-			log.Fatalf("Error creating favicon file: %v", err)
+	if err := registerMIMETypes(*mimeTypes); err != nil {
+		log.Fatalf("Error parsing --mime: %v", err)
+	}
+
+	cacheRules, err := parseCacheControl(*cacheControlSpec)
+	if err != nil {
+		log.Fatalf("Error parsing --cache-control: %v", err)
+	}
+
+	allowPrefixes, err := parseCIDRs(*allowCIDRs)
+	if err != nil {
+		log.Fatalf("Error parsing --allow: %v", err)
+	}
+	denyPrefixes, err := parseCIDRs(*denyCIDRs)
+	if err != nil {
+		log.Fatalf("Error parsing --deny: %v", err)
+	}
+	if err := validDefaultPolicy(*defaultPolicy); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	if err := validDirLostPolicy(*onDirLost); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	if err := validETagMode(*etagMode); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	if *rootFile != "" {
+		if stat, err := os.Stat(*rootFile); err != nil || stat.IsDir() {
+			log.Fatalf("Error: --root-file %s is not a readable file", *rootFile)
 		}
-		defer out.Close()
+	}
 
-		_, err = io.Copy(out, resp.Body)
+	var listingTmpl *template.Template
+	if *listingTemplate != "" {
+		listingTmpl, err = template.ParseFiles(*listingTemplate)
 		if err != nil {
-			log.Fatalf("Error writing favicon file: %v", err)
+			log.Fatalf("Error parsing --listing-template: %v", err)
 		}
 	}
 
-	startTime = time.Now()
+	if *faviconURL != "" {
+		if err := validFaviconURL(*faviconURL); err != nil {
+			log.Fatalf("Error parsing --favicon-url: %v", err)
+		}
+	}
 
-	r := mux.NewRouter().StrictSlash(true)
-	r.Use(loggingMiddleware)
+	if *defaultContentType != "" {
+		if _, _, err := mime.ParseMediaType(*defaultContentType); err != nil {
+			log.Fatalf("Error parsing --default-content-type: %v", err)
+		}
+	}
 
-	staticFileHandler := http.StripPrefix("/static/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		filePath := filepath.Join(*staticFileDir, r.URL.Path)
-		file, err := os.Open(filePath)
+	var fallback *originFallback
+	if *fallbackOrigin != "" {
+		fallback, err = newOriginFallback(*fallbackOrigin, *fallbackCache)
 		if err != nil {
-			http.Error(w, "HTTP 404: Static Server "+serVer+" - File not found", http.StatusNotFound)
-			return
+			log.Fatalf("Error parsing --fallback-origin: %v", err)
 		}
-		defer file.Close()
+	}
 
-		stat, err := file.Stat()
+	var authUsers map[string]string
+	if *authSpec != "" {
+		authUsers, err = loadAuth(*authSpec)
 		if err != nil {
-			http.Error(w, "HTTP 500: Static Server "+serVer+" - Error accessing file", http.StatusInternalServerError)
-			return
+			log.Fatalf("Error loading --auth: %v", err)
 		}
+	}
 
-		if stat.IsDir() {
-			http.Error(w, "HTTP 403: Static Server "+serVer+" - Directory listing is not allowed", http.StatusForbidden)
-			return
+	if *checkOnly {
+		dirs := []string{*staticFileDir}
+		for _, m := range mounts {
+			dirs = append(dirs, m.dir)
 		}
+		runChecks(*configFile, dirs, *certFile, *keyFile, *socketPath, net.JoinHostPort(*host, *port))
+		return
+	}
 
-		http.ServeFile(w, r, filePath)
-	}))
-	r.PathPrefix("/static/").Handler(staticFileHandler)
+	initAccessLog(*logFile, *logFormat)
+	accessLogQuiet, accessLogVerbose = *quiet, *verbose
+	trustProxy = *trustProxyHeaders
+	statsExclude = parsePathList(*statsExcludeSpec)
+	initFolders(*staticFileDir, !*noCreateDir)
+	errorPagesDir = *staticFileDir
 
-	r.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		http.Error(w, "HTTP 404: Static Server "+serVer+" - That file was not found", http.StatusNotFound)
-	})
+	var reloader *liveReload
+	if *liveReloadEnabled {
+		reloader = newLiveReload()
+	}
 
-	r.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "text/html")
-		fmt.Fprintf(w, `<!DOCTYPE html>
-<html>
-<head>
-	<title>Static Server %s</title>
-	<style>
-			body {
-					font-family: monospace, sans-serif;
-					display: flex;
-					justify-content: center;
-					align-items: center;
-					height: 100vh;
-					margin: 0;
+	if *watch || reloader != nil {
+		watcher, err := watchDirectory(*staticFileDir, func(event fsnotify.Event) {
+			if *watch {
+				logFileEvent(event)
 			}
-			p {
-					text-align: center;
+			if reloader != nil {
+				reloader.broadcast()
 			}
-	</style>
-</head>
-<body>
-	<div>
-			<p>Static Server %s</p>
-			<p>OMG It works ;)</p>
-	</div>
-	<span style="position: absolute; bottom: 10px; right: 10px;">%s</span>
-</body>
-</html>`, serVer, serVer, serVer)
-	})
+		})
+		if err != nil {
+			log.Fatalf("Error watching %s: %v", *staticFileDir, err)
+		}
+		defer watcher.Close()
+	}
 
-	r.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
+	faviconPath := filepath.Join(*staticFileDir, "favicon.ico")
+	var downloads []assetDownload
+	if *faviconURL != "" && !*noFavicon {
+		downloads = append(downloads, assetDownload{name: "favicon", url: *faviconURL, dest: faviconPath, maxSize: maxFaviconSize})
+	}
+	downloadAssets(downloads, *downloadTimeout)
+
+	ready.Store(true)
+	maintenanceOn.Store(*maintenanceFlag)
+	startTime = time.Now()
+	go sampleCPU(cpuSampleInterval)
+	if !*embedded {
+		go monitorDirectory(*staticFileDir, *onDirLost, dirCheckInterval)
+	}
+	requestCounts = newRequestCounter(*slidingWindowDuration)
+	pathCounts = newPathCounter(*slidingWindowDuration)
+
+	rootFiles := &staticHandler{
+		dir:        *staticFileDir,
+		indexFile:  *indexFile,
+		cacheRules: cacheRules,
+		spa:        *spaMode,
+		dev:        *devMode,
+		dotfiles:   *serveDotfiles,
+
+		listingTemplate: listingTmpl,
+		liveReload:      reloader != nil,
+		fallback:        fallback,
+		noSniff:         *noSniff,
+		followSymlinks:  *followSymlinks,
+
+		defaultContentType: *defaultContentType,
+		maxFileSize:        *maxFileSize,
+		bufferSize:         *bufferSize,
+		emitExpires:        *emitExpires,
+		blockedExts:        parseExtensions(*blockExt),
+		etagMode:           *etagMode,
+		hashes:             newIntegrityCache(),
+	}
+	if *maxBandwidth > 0 {
+		rootFiles.bandwidth = newBandwidthLimiter(*maxBandwidth)
+	}
+	if *templateMode {
+		rootFiles.templates = newTemplateCache()
+	}
+
+	for _, m := range mounts {
+		initFolders(m.dir, !*noCreateDir)
+	}
+	prefix := cleanPrefix(*staticPrefix)
+	cfg := &routerConfig{
+		files:    rootFiles,
+		prefix:   prefix,
+		mounts:   mounts,
+		rootFile: *rootFile,
+
+		authUsers:   authUsers,
+		adminToken:  *adminToken,
+		strictSlash: *strictSlash,
+
+		hideVersion:     *hideVersion,
+		maxRequestSize:  *maxRequestSize,
+		allowCIDRs:      allowPrefixes,
+		denyCIDRs:       denyPrefixes,
+		defaultPolicy:   *defaultPolicy,
+		maxConcurrent:   *maxConcurrent,
+		queueTimeout:    *queueTimeout,
+		rateLimit:       *rateLimit,
+		rateBurst:       *rateBurst,
+		securityHeaders: *securityHeaders,
+		csp:             *csp,
+		corsOrigins:     parseOrigins(*corsOrigins),
+		headers:         headers,
+		compression:     *compression,
+		compressMinSize: *compressMinSize,
+		noCompressExts:  parseExtensions(*noCompressExt),
+
+		statsWindow:      *slidingWindowDuration,
+		statsTopN:        *statsTopN,
+		metrics:          *metricsEnabled,
+		metricsExemplars: *metricsExemplars,
+		reloader:         reloader,
+		favicon:          !*noFavicon,
+		faviconPath:      faviconPath,
+	}
+	if *embedded {
+		cfg.embedded = embeddedSite
+	}
+	r := newRouter(cfg)
+
+	var handler http.Handler = r
+	if *h2cEnabled {
+		handler = h2c.NewHandler(r, &http2.Server{})
+	}
+
+	server := &http.Server{
+		Addr:              net.JoinHostPort(*host, *port),
+		Handler:           handler,
+		ReadTimeout:       *readTimeout,
+		ReadHeaderTimeout: *readTimeout,
+		WriteTimeout:      *writeTimeout,
+		IdleTimeout:       *idleTimeout,
+		MaxHeaderBytes:    *maxHeaderSize,
+		ConnState:         trackConnState,
+	}
+
+	var redirectServer *http.Server
+	if *redirectHTTP {
+		redirectServer = newRedirectServer(net.JoinHostPort(*host, *redirectPort), httpsRedirectHandler(*port))
+	}
+
+	if *autocertDomains != "" {
+		certManager := newAutocertManager(*autocertDomains, *autocertCache)
+		server.Addr = net.JoinHostPort(*host, "443")
+		server.TLSConfig = certManager.TLSConfig()
+		redirectServer = newRedirectServer(net.JoinHostPort(*host, "80"), certManager.HTTPHandler(httpsRedirectHandler("443")))
+	}
 
-		ramUse, threadsUse, uptimeStr, requests := stats(*slidingWindowDuration)
-		data := map[string]interface{}{
-			"Name":           "Static Server - https://github.com/donuts-are-good/static",
-			"Version":        serVer,
-			"Uptime":         uptimeStr,
-			"Threads":        threadsUse,
-			"Ram Usage":      ramUse,
-			"Requests (60s)": requests,
+	var ln net.Listener
+	if fd := inheritedFD(*listenFD); fd > 0 {
+		ln, err = fileListener(fd)
+	} else {
+		ln, err = listen(*socketPath, server.Addr)
+	}
+	if err != nil {
+		log.Fatalf("Error starting server: %v", err)
+	}
+
+	if !*quiet {
+		var features []string
+		for _, f := range []struct {
+			name    string
+			enabled bool
+		}{
+			{"compression=" + *compression, *compression != "none"},
+			{"auth", authUsers != nil},
+			{"cors", *corsOrigins != ""},
+			{"ratelimit", *rateLimit > 0},
+			{"max-concurrent", *maxConcurrent > 0},
+			{"max-bandwidth", *maxBandwidth > 0},
+			{"maintenance", *maintenanceFlag},
+			{"ip-filter", *allowCIDRs != "" || *denyCIDRs != "" || *defaultPolicy != "allow"},
+			{"spa", *spaMode},
+			{"dev", *devMode},
+			{"template", *templateMode},
+			{"livereload", reloader != nil},
+			{"watch", *watch},
+			{"fallback-origin", fallback != nil},
+			{"metrics", *metricsEnabled},
+			{"h2c", *h2cEnabled},
+			{"redirect-http", redirectServer != nil},
+		} {
+			if f.enabled {
+				features = append(features, f.name)
+			}
+		}
+
+		tls := "off"
+		if *autocertDomains != "" {
+			tls = "autocert"
+		} else if tlsEnabled {
+			tls = "on"
+		}
+		log.Printf("Static Server %s listening on %s, serving %s at %s (TLS %s; features: %s)",
+			serVer, ln.Addr(), *staticFileDir, prefix, tls, strings.Join(features, ", "))
+	}
+
+	go func() {
+		var err error
+		if tlsEnabled {
+			err = server.ServeTLS(ln, *certFile, *keyFile)
+		} else {
+			err = server.Serve(ln)
 		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Error starting server: %v", err)
+		}
+	}()
+
+	if *openFlag {
+		if *socketPath != "" {
+			log.Println("Not opening a browser: serving on a Unix socket")
+		} else if isInteractive() {
+			scheme := "http"
+			if tlsEnabled {
+				scheme = "https"
+			}
+			browserHost, browserPort, _ := net.SplitHostPort(server.Addr)
+			if browserHost == "" || net.ParseIP(browserHost).IsUnspecified() {
+				browserHost = "localhost"
+			}
+			openBrowser(scheme + "://" + net.JoinHostPort(browserHost, browserPort) + "/")
+		}
+	}
 
-		jsonData, err := json.Marshal(data)
+	if redirectServer != nil {
+		redirectLn, err := listen("", redirectServer.Addr)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+			log.Fatalf("Error starting HTTP redirect listener: %v", err)
 		}
+		go func() {
+			if err := redirectServer.Serve(redirectLn); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Fatalf("Error starting HTTP redirect listener: %v", err)
+			}
+		}()
+	}
 
-		fmt.Fprint(w, string(jsonData))
-	})
+	if accessLogFile != nil {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		go func() {
+			for range hup {
+				if err := accessLogFile.Reopen(); err != nil {
+					log.Printf("Error reopening log file: %v", err)
+				}
+			}
+		}()
+	}
 
-	r.HandleFunc("/favicon.ico", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "image/x-icon")
-		http.ServeFile(w, r, "./web/favicon.ico")
-	})
+	usr1 := make(chan os.Signal, 1)
+	notifyMaintenanceToggle(usr1)
+	go toggleMaintenance(usr1)
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
 
-	http.ListenAndServe(":"+*port, r)
+	log.Println("Shutting down server...")
+	ctx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
+
+	if redirectServer != nil {
+		if err := redirectServer.Shutdown(ctx); err != nil {
+			log.Printf("Error during redirect listener shutdown: %v", err)
+		}
+	}
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Error during shutdown: %v", err)
+	}
+	if *socketPath != "" {
+		os.Remove(*socketPath)
+	}
+	log.Println("Server stopped")
 }
 
-func initFolders(dir string) {
+func initFolders(dir string, create bool) {
 	if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+		if !create {
+			log.Fatalf("Error: directory %s does not exist (it is not created because of --no-create-dir)", dir)
+		}
 		err := os.MkdirAll(dir, os.ModePerm)
 		if err != nil {
 			log.Fatalf("Error creating directory: %v", err)
@@ -192,56 +678,150 @@ func initFolders(dir string) {
 
 func loggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.URL.Path != "/favicon.ico" && r.URL.Path != "/" {
-			log.Println(r.Method, r.URL.Path)
+		start := time.Now()
+		rec := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		duration := time.Since(start)
+		recordMetrics(r, rec.statusCode(), rec.bytes, duration)
+		if shouldLogAccess(r.URL.Path) {
+			logAccess(r, rec.statusCode(), rec.bytes, start, duration, rec.timeToFirstByte(start, duration))
 		}
-		next.ServeHTTP(w, r)
-		if r.URL.Path != "/favicon.ico" {
-			requestTimestamps.Lock()
-			requestTimestamps.timestamps = append(requestTimestamps.timestamps, time.Now())
-			requestTimestamps.Unlock()
+		if countsInStats(r.URL.Path) {
+			requestCounts.record(time.Now())
+			if rec.statusCode() < http.StatusBadRequest {
+				pathCounts.record(time.Now(), r.URL.Path)
+			}
 		}
 	})
 }
 
-func stats(slidingWindowDuration time.Duration) (string, string, string, int) {
-	var m runtime.MemStats
-	runtime.ReadMemStats(&m)
-	ramUse := fmt.Sprintf("%v MiB", bToMb(m.Sys))
+func countsInStats(urlPath string) bool {
+	if urlPath == "/favicon.ico" {
+		return false
+	}
+	for _, excluded := range statsExclude {
+		if urlPath == excluded || strings.HasPrefix(urlPath, strings.TrimSuffix(excluded, "/")+"/") {
+			return false
+		}
+	}
+	return true
+}
 
-	threadsUse := fmt.Sprintf("%d/%d", runtime.GOMAXPROCS(0), runtime.NumCPU())
+func parsePathList(spec string) []string {
+	var paths []string
+	for _, p := range strings.Split(spec, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			paths = append(paths, "/"+strings.TrimPrefix(p, "/"))
+		}
+	}
+	return paths
+}
 
-	uptime := time.Since(startTime)
-	days := uptime / (24 * time.Hour)
-	hours := (uptime % (24 * time.Hour)) / time.Hour
-	minutes := (uptime % time.Hour) / time.Minute
-	seconds := (uptime % time.Minute) / time.Second
+func serveStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	s := stats()
+	uncompressed, compressed := compressionStats()
+	data := map[string]interface{}{
+		"Name":                        "Static Server - https://github.com/donuts-are-good/static",
+		"Version":                     serVer,
+		"Uptime":                      formatUptime(s.UptimeSeconds),
+		"Threads":                     fmt.Sprintf("%d/%d", s.MaxProcs, s.NumCPU),
+		"CPU Usage (%)":               math.Round(s.CPUPercent*10) / 10,
+		"Goroutines":                  s.Goroutines,
+		"Active Connections":          activeConnections.Load(),
+		"Ram Usage":                   fmt.Sprintf("%v MiB", bToMb(s.RAMBytes)),
+		"Requests (60s)":              s.Requests,
+		"Bytes Served":                formatBytes(bytesServed()),
+		"Bytes Served (uncompressed)": formatBytes(uncompressed),
+		"Bytes Served (compressed)":   formatBytes(compressed),
+		"Compression Ratio":           compressionRatio(uncompressed, compressed),
+		"Requests Per Second":         requestCounts.series(time.Now()),
+	}
+
+	jsonData, err := marshalJSON(r, data)
+	if err != nil {
+		httpError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
 
-	uptimeStr := fmt.Sprintf("%d days %d hours %d minutes %d seconds", days, hours, minutes, seconds)
+	fmt.Fprint(w, string(jsonData))
+}
 
-	requestTimestamps.Lock()
-	defer requestTimestamps.Unlock()
-	var requests int
-	cutoff := time.Now().Add(-slidingWindowDuration)
+func statsFilesHandler(window time.Duration, topN int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
 
-	maxAge := time.Now().Add(-2 * slidingWindowDuration)
-	filteredTimestamps := []time.Time{}
-	for _, ts := range requestTimestamps.timestamps {
-		if ts.After(maxAge) {
-			filteredTimestamps = append(filteredTimestamps, ts)
+		jsonData, err := marshalJSON(r, map[string]interface{}{
+			"Window": window.String(),
+			"Files":  pathCounts.top(time.Now(), topN),
+		})
+		if err != nil {
+			httpError(w, r, http.StatusInternalServerError, err.Error())
+			return
 		}
+
+		fmt.Fprint(w, string(jsonData))
 	}
-	requestTimestamps.timestamps = filteredTimestamps
+}
 
-	for _, ts := range requestTimestamps.timestamps {
-		if ts.After(cutoff) {
-			requests++
-		}
+// Stats is a point-in-time snapshot of the process and request counters.
+type Stats struct {
+	RAMBytes      uint64
+	Goroutines    int
+	MaxProcs      int
+	NumCPU        int
+	CPUPercent    float64
+	UptimeSeconds float64
+	Requests      int
+}
+
+func stats() Stats {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	return Stats{
+		RAMBytes:      m.Sys,
+		Goroutines:    runtime.NumGoroutine(),
+		MaxProcs:      runtime.GOMAXPROCS(0),
+		NumCPU:        runtime.NumCPU(),
+		CPUPercent:    cpuUsage(),
+		UptimeSeconds: time.Since(startTime).Seconds(),
+		Requests:      requestCounts.count(time.Now()),
 	}
+}
 
-	return ramUse, threadsUse, uptimeStr, requests
+func formatUptime(seconds float64) string {
+	uptime := time.Duration(seconds * float64(time.Second))
+	days := uptime / (24 * time.Hour)
+	hours := (uptime % (24 * time.Hour)) / time.Hour
+	minutes := (uptime % time.Hour) / time.Minute
+	secs := (uptime % time.Minute) / time.Second
+
+	return fmt.Sprintf("%d days %d hours %d minutes %d seconds", days, hours, minutes, secs)
 }
 
 func bToMb(b uint64) uint64 {
 	return b / 1024 / 1024
 }
+
+// marshalJSON encodes v compactly, or indented when the request asks for
+// ?pretty=true, which is easier to read in a browser.
+func marshalJSON(r *http.Request, v interface{}) ([]byte, error) {
+	if pretty, _ := strconv.ParseBool(r.URL.Query().Get("pretty")); pretty {
+		return json.MarshalIndent(v, "", "  ")
+	}
+	return json.Marshal(v)
+}
+
+func formatBytes(b uint64) string {
+	switch {
+	case b >= 1024*1024*1024:
+		return fmt.Sprintf("%.2f GiB", float64(b)/1024/1024/1024)
+	case b >= 1024*1024:
+		return fmt.Sprintf("%.2f MiB", float64(b)/1024/1024)
+	case b >= 1024:
+		return fmt.Sprintf("%.2f KiB", float64(b)/1024)
+	}
+	return fmt.Sprintf("%d B", b)
+}
@@ -0,0 +1,516 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// runMainEnv makes TestMain run main instead of the tests, so a test can
+// start the real server by re-executing its own binary.
+const runMainEnv = "STATIC_TEST_RUN_MAIN"
+
+var listeningOn = regexp.MustCompile(`listening on (\S+),`)
+
+// startServer runs main with args on a random loopback port and returns
+// its address once it is listening, along with its log output.
+func startServer(t *testing.T, args ...string) (string, *exec.Cmd, *syncBuffer) {
+	t.Helper()
+	args = append([]string{"--host", "127.0.0.1", "--port", "0"}, args...)
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), runMainEnv+"=1")
+	addr, logs := startCommand(t, cmd)
+	return addr, cmd, logs
+}
+
+// startCommand starts cmd, a re-exec of the test binary running main, and
+// waits for it to log its listening address.
+func startCommand(t *testing.T, cmd *exec.Cmd) (string, *syncBuffer) {
+	t.Helper()
+	logs := &syncBuffer{}
+	cmd.Stdout = logs
+	cmd.Stderr = logs
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if cmd.ProcessState == nil {
+			cmd.Process.Kill()
+			cmd.Wait()
+		}
+	})
+
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		if m := listeningOn.FindStringSubmatch(logs.String()); m != nil {
+			return m[1], logs
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("server did not start:\n%s", logs)
+	return "", nil
+}
+
+// runMain runs main with args to completion and returns its output.
+func runMain(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), runMainEnv+"=1")
+	out, err := cmd.CombinedOutput()
+	return string(out), err
+}
+
+// waitForLog waits until the server has logged want.
+func waitForLog(t *testing.T, logs *syncBuffer, want string) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for !strings.Contains(logs.String(), want) {
+		if time.Now().After(deadline) {
+			t.Fatalf("server never logged %q:\n%s", want, logs)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestShutdownFinishesInFlightRequest(t *testing.T) {
+	dir := t.TempDir()
+	const size = 256 << 10
+	data := writeLargeTestFile(t, filepath.Join(dir, "large.bin"), size)
+	// Throttled to a couple of seconds, long enough to signal mid-download.
+	addr, cmd, logs := startServer(t, "--directory", dir, "--max-bandwidth", "100000")
+
+	resp, err := http.Get("http://" + addr + "/static/large.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if err := cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	waitForLog(t, logs, "Shutting down server...")
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil || string(body) != string(data) {
+		t.Fatalf("in-flight download read %d of %d bytes (err %v)", len(body), size, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("server exited with %v:\n%s", err, logs)
+		}
+	case <-ctx.Done():
+		t.Fatal("server did not exit after the download finished")
+	}
+	if !strings.Contains(logs.String(), "Server stopped") {
+		t.Errorf("shutdown completion not logged:\n%s", logs)
+	}
+}
+
+// writeTestCert writes a self-signed certificate for 127.0.0.1 and its key
+// into dir and returns their paths and the certificate.
+func writeTestCert(t *testing.T, dir string) (string, string, *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "static test"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPath, keyPath := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeTestFile(t, certPath, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})))
+	writeTestFile(t, keyPath, string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})))
+	return certPath, keyPath, cert
+}
+
+func TestTLS(t *testing.T) {
+	dir, certDir := t.TempDir(), t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "a.txt"), "hello")
+	certPath, keyPath, cert := writeTestCert(t, certDir)
+	addr, _, _ := startServer(t, "--directory", dir, "--cert", certPath, "--key", keyPath)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+	resp, err := client.Get("https://" + addr + "/static/a.txt")
+	if err != nil {
+		t.Fatalf("TLS request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.TLS == nil || resp.StatusCode != http.StatusOK || string(body) != "hello" {
+		t.Errorf("GET over TLS = %d %q (TLS %v), want 200 \"hello\"", resp.StatusCode, body, resp.TLS != nil)
+	}
+}
+
+func TestTLSRequiresCertAndKey(t *testing.T) {
+	certPath, keyPath, _ := writeTestCert(t, t.TempDir())
+	for _, args := range [][]string{
+		{"--cert", certPath},
+		{"--key", keyPath},
+	} {
+		out, err := runMain(t, append([]string{"--directory", t.TempDir()}, args...)...)
+		if err == nil || !strings.Contains(out, "--cert and --key must be provided together") {
+			t.Errorf("%v: err %v, output %q; want a clear error", args, err, out)
+		}
+	}
+}
+
+func TestSlowHeadersAreCutOff(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "a.txt"), "hello")
+	addr, _, _ := startServer(t, "--directory", dir, "--read-timeout", "200ms")
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// Half a request line, then nothing: the headers never complete.
+	if _, err := io.WriteString(conn, "GET /static/a.txt HTTP/1.1\r\nHost: x\r\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	io.ReadAll(conn)
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("slow client kept its connection for %s, want it closed after the 200ms --read-timeout", elapsed)
+	}
+}
+
+func TestSIGHUPReopensLogFile(t *testing.T) {
+	dir, logDir := t.TempDir(), t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "a.txt"), "hello")
+	logPath := filepath.Join(logDir, "access.log")
+	addr, cmd, _ := startServer(t, "--directory", dir, "--logfile", logPath)
+
+	get := func(target string) {
+		t.Helper()
+		resp, err := http.Get("http://" + addr + target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+
+	get("/static/a.txt?before")
+	rotated := logPath + ".1"
+	if err := os.Rename(logPath, rotated); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Process.Signal(syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(logPath); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("SIGHUP did not recreate the log file")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	get("/static/a.txt?after")
+
+	// The line is written once the handler returns, which can be just
+	// after the client has the response.
+	var fresh []byte
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if fresh, _ = os.ReadFile(logPath); len(fresh) > 0 {
+			break
+		}
+	}
+	old, _ := os.ReadFile(rotated)
+	if strings.Count(string(old), "/static/a.txt") != 1 {
+		t.Errorf("rotated log = %q, want only the request before SIGHUP", old)
+	}
+	if strings.Count(string(fresh), "/static/a.txt") != 1 {
+		t.Errorf("fresh log = %q, want the request after SIGHUP", fresh)
+	}
+}
+
+func TestUnixSocket(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "a.txt"), "hello")
+	socketPath := filepath.Join(t.TempDir(), "static.sock")
+
+	// A socket left behind by a crashed server is replaced.
+	stale, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	addr, cmd, logs := startServer(t, "--directory", dir, "--socket", socketPath)
+	if addr != socketPath {
+		t.Errorf("server listening on %s, want the socket %s", addr, socketPath)
+	}
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socketPath)
+		},
+	}}
+	resp, err := client.Get("http://static/static/a.txt")
+	if err != nil {
+		t.Fatalf("GET over the socket: %v\n%s", err, logs)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "hello" {
+		t.Errorf("GET over the socket = %d %q, want 200 \"hello\"", resp.StatusCode, body)
+	}
+
+	cmd.Process.Signal(syscall.SIGTERM)
+	if err := cmd.Wait(); err != nil {
+		t.Fatalf("server exited with %v:\n%s", err, logs)
+	}
+	if _, err := os.Stat(socketPath); !os.IsNotExist(err) {
+		t.Errorf("socket %s left behind after shutdown (err %v)", socketPath, err)
+	}
+}
+
+func TestH2C(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "a.txt"), "hello")
+	addr, _, _ := startServer(t, "--directory", dir, "--h2c")
+
+	h2c := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}}
+	for _, c := range []struct {
+		client    *http.Client
+		wantMajor int
+	}{
+		{h2c, 2},
+		{http.DefaultClient, 1},
+	} {
+		resp, err := c.client.Get("http://" + addr + "/static/a.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.ProtoMajor != c.wantMajor || string(body) != "hello" {
+			t.Errorf("GET = %s %q, want HTTP/%d \"hello\"", resp.Proto, body, c.wantMajor)
+		}
+	}
+}
+
+func TestHostBindsOneAddress(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("relies on all of 127.0.0.0/8 being local, as on Linux")
+	}
+	addr, _, _ := startServer(t, "--directory", t.TempDir())
+	_, port, _ := net.SplitHostPort(addr)
+
+	if conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", port)); err != nil {
+		t.Errorf("--host 127.0.0.1 is not reachable on 127.0.0.1: %v", err)
+	} else {
+		conn.Close()
+	}
+	if conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.2", port)); err == nil {
+		conn.Close()
+		t.Error("--host 127.0.0.1 is reachable on 127.0.0.2")
+	}
+}
+
+func TestMissingDirectory(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "typo")
+	out, err := runMain(t, "--directory", missing, "--no-create-dir", "--port", "0")
+	if err == nil || !strings.Contains(out, "does not exist") {
+		t.Errorf("--no-create-dir with a missing directory: err %v, output %q; want a clear error", err, out)
+	}
+	if _, err := os.Stat(missing); !os.IsNotExist(err) {
+		t.Errorf("--no-create-dir created %s", missing)
+	}
+
+	startServer(t, "--directory", missing)
+	if stat, err := os.Stat(missing); err != nil || !stat.IsDir() {
+		t.Errorf("default startup did not create %s (err %v)", missing, err)
+	}
+}
+
+func TestPortInUse(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+
+	out, err := runMain(t, "--directory", t.TempDir(), "--host", "127.0.0.1", "--port", port)
+	if err == nil || !strings.Contains(out, "port "+port+" is already in use") {
+		t.Errorf("starting on a busy port: err %v, output %q; want an \"already in use\" error", err, out)
+	}
+}
+
+func TestDescribeListenError(t *testing.T) {
+	for _, c := range []struct {
+		err  error
+		want string
+	}{
+		{syscall.EADDRINUSE, "port 8080 is already in use"},
+		{syscall.EACCES, "permission denied binding port 8080"},
+		{syscall.ECONNREFUSED, syscall.ECONNREFUSED.Error()},
+	} {
+		err := describeListenError("127.0.0.1:8080", &net.OpError{Op: "listen", Err: c.err})
+		if !strings.Contains(err.Error(), c.want) || !errors.Is(err, c.err) {
+			t.Errorf("describeListenError(%v) = %q, want it to mention %q and wrap the cause", c.err, err, c.want)
+		}
+	}
+}
+
+func TestListenFD(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "a.txt"), "hello")
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := ln.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ln.Addr().String()
+	ln.Close()
+
+	cmd := exec.Command(os.Args[0], "--directory", dir, "--listen-fd", "3")
+	cmd.Env = append(os.Environ(), runMainEnv+"=1")
+	cmd.ExtraFiles = []*os.File{f}
+	addr, _ := startCommand(t, cmd)
+	f.Close()
+	if addr != want {
+		t.Errorf("server listening on %s, want the inherited %s", addr, want)
+	}
+
+	resp, err := http.Get("http://" + want + "/static/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "hello" {
+		t.Errorf("GET over the inherited socket = %d %q, want 200 hello", resp.StatusCode, body)
+	}
+}
+
+func TestInheritedFD(t *testing.T) {
+	if fd := inheritedFD(5); fd != 5 {
+		t.Errorf("inheritedFD(5) = %d, want the flag value", fd)
+	}
+	t.Setenv("LISTEN_FDS", "1")
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()+1))
+	if fd := inheritedFD(0); fd != 0 {
+		t.Errorf("inheritedFD with another process's LISTEN_PID = %d, want 0", fd)
+	}
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	if fd := inheritedFD(0); fd != sdListenFDsStart {
+		t.Errorf("inheritedFD under socket activation = %d, want %d", fd, sdListenFDsStart)
+	}
+	if _, ok := os.LookupEnv("LISTEN_FDS"); ok {
+		t.Error("LISTEN_FDS left set for child processes")
+	}
+}
+
+func TestStartupSummary(t *testing.T) {
+	dir := t.TempDir()
+	addr, _, logs := startServer(t, "--directory", dir, "--compression", "gzip", "--cors-origins", "*")
+	summary := logs.String()
+	for _, want := range []string{"Static Server " + serVer, "listening on " + addr, "serving " + dir + " at /static/", "TLS off", "compression=gzip", "cors"} {
+		if !strings.Contains(summary, want) {
+			t.Errorf("startup summary lacks %q:\n%s", want, summary)
+		}
+	}
+}
+
+func TestQuietStartup(t *testing.T) {
+	free, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := free.Addr().String()
+	_, port, _ := net.SplitHostPort(addr)
+	free.Close()
+
+	cmd := exec.Command(os.Args[0], "--directory", t.TempDir(), "--host", "127.0.0.1", "--port", port, "--quiet")
+	cmd.Env = append(os.Environ(), runMainEnv+"=1")
+	logs := &syncBuffer{}
+	cmd.Stdout, cmd.Stderr = logs, logs
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		resp, err := http.Get("http://" + addr + "/healthz")
+		if err == nil {
+			resp.Body.Close()
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("--quiet server never came up:\n%s", logs)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if strings.Contains(logs.String(), "listening on") {
+		t.Errorf("--quiet printed the startup summary:\n%s", logs)
+	}
+}
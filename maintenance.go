@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/gorilla/mux"
+)
+
+const maintenanceRetryAfter = 300
+
+// maintenanceOn is set by --maintenance and flipped by SIGUSR1.
+var maintenanceOn atomic.Bool
+
+// toggleMaintenance flips maintenance mode whenever a signal arrives.
+func toggleMaintenance(signals <-chan os.Signal) {
+	for range signals {
+		on := !maintenanceOn.Load()
+		maintenanceOn.Store(on)
+		if on {
+			log.Println("Maintenance mode on")
+		} else {
+			log.Println("Maintenance mode off")
+		}
+	}
+}
+
+// inMaintenance reports whether requests should get the maintenance page:
+// when the mode is switched on, or while a .maintenance file exists in dir.
+func inMaintenance(dir string) bool {
+	if maintenanceOn.Load() {
+		return true
+	}
+	_, err := os.Stat(filepath.Join(dir, ".maintenance"))
+	return !errors.Is(err, fs.ErrNotExist)
+}
+
+// maintenanceMiddleware answers everything but the health checks with 503
+// and dir's maintenance.html while in maintenance. It is also wrapped
+// around the NotFoundHandler, which mux middleware does not reach.
+func maintenanceMiddleware(dir string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isHealthProbe(r.URL.Path) || !inMaintenance(dir) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("Retry-After", strconv.Itoa(maintenanceRetryAfter))
+			w.Header().Set("Cache-Control", "no-store")
+			page, err := os.ReadFile(filepath.Join(dir, "maintenance.html"))
+			if err != nil || prefersJSON(r) {
+				httpError(w, r, http.StatusServiceUnavailable, "Down for maintenance")
+				return
+			}
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write(page)
+		})
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// notifyMaintenanceToggle does nothing where there is no SIGUSR1; the
+// .maintenance file and --maintenance still work.
+func notifyMaintenanceToggle(c chan<- os.Signal) {}
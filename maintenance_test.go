@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMaintenanceFile(t *testing.T) {
+	dir, cfg := newTestConfig(t)
+	page := "<h1>Back soon</h1>"
+	writeTestFile(t, filepath.Join(dir, "maintenance.html"), page)
+	r := newRouter(cfg)
+
+	if rec := serveRouter(r, http.MethodGet, "/static/a.txt", ""); rec.Code != http.StatusOK {
+		t.Fatalf("GET /static/a.txt before maintenance = %d, want 200", rec.Code)
+	}
+
+	marker := filepath.Join(dir, ".maintenance")
+	writeTestFile(t, marker, "")
+	for _, target := range []string{"/static/a.txt", "/static/missing.txt", "/nowhere", "/stats"} {
+		rec := serveRouter(r, http.MethodGet, target, "")
+		if rec.Code != http.StatusServiceUnavailable || rec.Body.String() != page {
+			t.Errorf("GET %s in maintenance = %d %q, want 503 with maintenance.html", target, rec.Code, rec.Body.String())
+		}
+		if got := rec.Header().Get("Retry-After"); got != "300" {
+			t.Errorf("GET %s in maintenance: Retry-After = %q, want 300", target, got)
+		}
+		if got := rec.Header().Get("Cache-Control"); got != "no-store" {
+			t.Errorf("GET %s in maintenance: Cache-Control = %q, want no-store", target, got)
+		}
+	}
+	for _, target := range []string{"/healthz", "/readyz"} {
+		if rec := serveRouter(r, http.MethodGet, target, ""); rec.Code != http.StatusOK {
+			t.Errorf("GET %s in maintenance = %d, want 200", target, rec.Code)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/static/a.txt", nil)
+	req.Header.Set("Accept", "application/json")
+	if rec := serveRequest(r, req); rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("JSON client in maintenance = %d %q, want a 503 JSON error", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	os.Remove(filepath.Join(dir, "maintenance.html"))
+	if rec := serveRouter(r, http.MethodGet, "/static/a.txt", ""); rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "Down for maintenance") {
+		t.Errorf("maintenance without maintenance.html = %d %q, want the built-in 503", rec.Code, rec.Body.String())
+	}
+
+	os.Remove(marker)
+	if rec := serveRouter(r, http.MethodGet, "/static/a.txt", ""); rec.Code != http.StatusOK || rec.Header().Get("Retry-After") != "" {
+		t.Errorf("GET /static/a.txt after maintenance = %d with Retry-After %q, want 200 and none", rec.Code, rec.Header().Get("Retry-After"))
+	}
+}
+
+func TestMaintenanceFlag(t *testing.T) {
+	defer maintenanceOn.Store(false)
+	_, cfg := newTestConfig(t)
+	r := newRouter(cfg)
+
+	for _, on := range []bool{true, false, true} {
+		maintenanceOn.Store(on)
+		want := http.StatusOK
+		if on {
+			want = http.StatusServiceUnavailable
+		}
+		if rec := serveRouter(r, http.MethodGet, "/static/a.txt", ""); rec.Code != want {
+			t.Errorf("maintenance %v: GET /static/a.txt = %d, want %d", on, rec.Code, want)
+		}
+	}
+}
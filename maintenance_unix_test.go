@@ -0,0 +1,47 @@
+//go:build unix
+
+package main
+
+import (
+	"net/http"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestSIGUSR1TogglesMaintenance(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "a.txt"), "hello")
+	addr, cmd, logs := startServer(t, "--directory", dir)
+
+	status := func() int {
+		t.Helper()
+		resp, err := http.Get("http://" + addr + "/static/a.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	toggle := func(want int, logged string) {
+		t.Helper()
+		if err := cmd.Process.Signal(syscall.SIGUSR1); err != nil {
+			t.Fatal(err)
+		}
+		waitForLog(t, logs, logged)
+		deadline := time.Now().Add(5 * time.Second)
+		for status() != want {
+			if time.Now().After(deadline) {
+				t.Fatalf("GET /static/a.txt after SIGUSR1 = %d, want %d", status(), want)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	if got := status(); got != http.StatusOK {
+		t.Fatalf("GET /static/a.txt = %d, want 200", got)
+	}
+	toggle(http.StatusServiceUnavailable, "Maintenance mode on")
+	toggle(http.StatusOK, "Maintenance mode off")
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+var metrics = struct {
+	sync.Mutex
+	requests      uint64
+	responses     map[int]uint64
+	bytesServed   uint64
+	uncompressed  uint64
+	compressed    uint64
+	durationCount []uint64
+	durationSum   float64
+	exemplars     []exemplar
+}{
+	responses:     map[int]uint64{},
+	durationCount: make([]uint64, len(durationBuckets)+1),
+	exemplars:     make([]exemplar, len(durationBuckets)+1),
+}
+
+// exemplar is the most recent request that landed in a histogram bucket,
+// exposed with --metrics-exemplars so a latency spike can be traced back to
+// the request in the access log.
+type exemplar struct {
+	label string
+	id    string
+	value float64
+	time  time.Time
+}
+
+// maxExemplarLabelLength is the OpenMetrics limit on the combined length of
+// an exemplar's label names and values.
+const maxExemplarLabelLength = 128
+
+// requestExemplar picks the ID to attach to a request's exemplar: the trace
+// ID from a W3C traceparent header when there is one, otherwise the
+// request ID.
+func requestExemplar(r *http.Request) (label, id string) {
+	parts := strings.Split(r.Header.Get("traceparent"), "-")
+	if len(parts) == 4 && len(parts[1]) == 32 && isHex(parts[1]) {
+		return "trace_id", parts[1]
+	}
+	return "request_id", requestIDFrom(r.Context())
+}
+
+func isHex(s string) bool {
+	for _, c := range s {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// wantsOpenMetrics reports whether a scraper accepts the OpenMetrics text
+// format, the only one that can carry exemplars. An entry with q=0 means
+// the scraper refuses it.
+func wantsOpenMetrics(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, _ := strings.Cut(part, ";")
+		if strings.EqualFold(strings.TrimSpace(mediaType), "application/openmetrics-text") {
+			return parseQuality(params) > 0
+		}
+	}
+	return false
+}
+
+var activeConnections atomic.Int64
+
+// trackConnState counts open client connections; it is installed as the
+// server's ConnState hook. Hijacked connections, such as the live-reload
+// WebSocket, are no longer managed by the server and stop being counted.
+func trackConnState(_ net.Conn, state http.ConnState) {
+	switch state {
+	case http.StateNew:
+		activeConnections.Add(1)
+	case http.StateClosed, http.StateHijacked:
+		activeConnections.Add(-1)
+	}
+}
+
+type responseRecorder struct {
+	http.ResponseWriter
+	status    int
+	bytes     int64
+	firstByte time.Time
+}
+
+func (rec *responseRecorder) WriteHeader(code int) {
+	if rec.status == 0 {
+		rec.status = code
+		rec.firstByte = time.Now()
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+		rec.firstByte = time.Now()
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += int64(n)
+	return n, err
+}
+
+// ReadFrom keeps the underlying writer's io.ReaderFrom, and with it
+// sendfile, reachable through the recorder.
+func (rec *responseRecorder) ReadFrom(src io.Reader) (int64, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+		rec.firstByte = time.Now()
+	}
+	n, err := io.Copy(rec.ResponseWriter, src)
+	rec.bytes += n
+	return n, err
+}
+
+func (rec *responseRecorder) Flush() {
+	if f, ok := rec.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (rec *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := rec.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	rec.status = http.StatusSwitchingProtocols
+	return h.Hijack()
+}
+
+// timeToFirstByte is how long after start the response headers were sent,
+// or total when the handler never wrote anything.
+func (rec *responseRecorder) timeToFirstByte(start time.Time, total time.Duration) time.Duration {
+	if rec.firstByte.IsZero() {
+		return total
+	}
+	return rec.firstByte.Sub(start)
+}
+
+func (rec *responseRecorder) statusCode() int {
+	if rec.status == 0 {
+		return http.StatusOK
+	}
+	return rec.status
+}
+
+func recordMetrics(r *http.Request, status int, bytes int64, duration time.Duration) {
+	seconds := duration.Seconds()
+	bucket := sort.SearchFloat64s(durationBuckets, seconds)
+	label, id := requestExemplar(r)
+
+	metrics.Lock()
+	defer metrics.Unlock()
+	metrics.requests++
+	metrics.responses[status]++
+	metrics.bytesServed += uint64(bytes)
+	metrics.durationCount[bucket]++
+	metrics.durationSum += seconds
+	if id != "" && len(label)+len(id) <= maxExemplarLabelLength {
+		metrics.exemplars[bucket] = exemplar{label: label, id: id, value: seconds, time: time.Now()}
+	}
+}
+
+func resetMetrics() {
+	metrics.Lock()
+	defer metrics.Unlock()
+	metrics.requests = 0
+	metrics.responses = map[int]uint64{}
+	metrics.bytesServed = 0
+	metrics.uncompressed = 0
+	metrics.compressed = 0
+	metrics.durationCount = make([]uint64, len(durationBuckets)+1)
+	metrics.durationSum = 0
+	metrics.exemplars = make([]exemplar, len(durationBuckets)+1)
+}
+
+func bytesServed() uint64 {
+	metrics.Lock()
+	defer metrics.Unlock()
+	return metrics.bytesServed
+}
+
+func recordCompression(uncompressed, compressed int64) {
+	metrics.Lock()
+	defer metrics.Unlock()
+	metrics.uncompressed += uint64(uncompressed)
+	metrics.compressed += uint64(compressed)
+}
+
+func compressionStats() (uncompressed, compressed uint64) {
+	metrics.Lock()
+	defer metrics.Unlock()
+	return metrics.uncompressed, metrics.compressed
+}
+
+func compressionRatio(uncompressed, compressed uint64) string {
+	if uncompressed == 0 {
+		return "n/a"
+	}
+	return fmt.Sprintf("%.1f%%", float64(compressed)/float64(uncompressed)*100)
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// writeExemplar ends a bucket sample line, adding the bucket's exemplar in
+// OpenMetrics syntax when exemplars are being written.
+func writeExemplar(w io.Writer, withExemplars bool, e exemplar) {
+	if withExemplars && e.id != "" {
+		fmt.Fprintf(w, " # {%s=\"%s\"} %s %s",
+			e.label, labelValueEscaper.Replace(e.id),
+			strconv.FormatFloat(e.value, 'g', -1, 64),
+			strconv.FormatFloat(float64(e.time.UnixMilli())/1000, 'f', 3, 64))
+	}
+	fmt.Fprintln(w)
+}
+
+// writeMetrics writes the Prometheus text format, or with openMetrics the
+// OpenMetrics format, which names counter families without the _total
+// suffix, may carry exemplars and ends with # EOF.
+func writeMetrics(w io.Writer, openMetrics, withExemplars bool) {
+	metrics.Lock()
+	defer metrics.Unlock()
+
+	counterFamily := func(name string) string {
+		if openMetrics {
+			return strings.TrimSuffix(name, "_total")
+		}
+		return name
+	}
+	withExemplars = withExemplars && openMetrics
+
+	fmt.Fprintln(w, "# HELP "+counterFamily("static_http_requests_total")+" Total number of HTTP requests handled.")
+	fmt.Fprintln(w, "# TYPE "+counterFamily("static_http_requests_total")+" counter")
+	fmt.Fprintf(w, "static_http_requests_total %d\n", metrics.requests)
+
+	codes := make([]int, 0, len(metrics.responses))
+	for code := range metrics.responses {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+
+	fmt.Fprintln(w, "# HELP "+counterFamily("static_http_responses_total")+" Total number of HTTP responses by status code.")
+	fmt.Fprintln(w, "# TYPE "+counterFamily("static_http_responses_total")+" counter")
+	for _, code := range codes {
+		fmt.Fprintf(w, "static_http_responses_total{code=\"%d\"} %d\n", code, metrics.responses[code])
+	}
+
+	fmt.Fprintln(w, "# HELP static_http_request_duration_seconds Time spent serving HTTP requests.")
+	fmt.Fprintln(w, "# TYPE static_http_request_duration_seconds histogram")
+	var cumulative uint64
+	for i, le := range durationBuckets {
+		cumulative += metrics.durationCount[i]
+		fmt.Fprintf(w, "static_http_request_duration_seconds_bucket{le=\"%s\"} %d", strconv.FormatFloat(le, 'g', -1, 64), cumulative)
+		writeExemplar(w, withExemplars, metrics.exemplars[i])
+	}
+	cumulative += metrics.durationCount[len(durationBuckets)]
+	fmt.Fprintf(w, "static_http_request_duration_seconds_bucket{le=\"+Inf\"} %d", cumulative)
+	writeExemplar(w, withExemplars, metrics.exemplars[len(durationBuckets)])
+	fmt.Fprintf(w, "static_http_request_duration_seconds_sum %s\n", strconv.FormatFloat(metrics.durationSum, 'g', -1, 64))
+	fmt.Fprintf(w, "static_http_request_duration_seconds_count %d\n", cumulative)
+
+	fmt.Fprintln(w, "# HELP "+counterFamily("static_http_response_bytes_total")+" Total number of response body bytes served.")
+	fmt.Fprintln(w, "# TYPE "+counterFamily("static_http_response_bytes_total")+" counter")
+	fmt.Fprintf(w, "static_http_response_bytes_total %d\n", metrics.bytesServed)
+
+	if openMetrics {
+		fmt.Fprintln(w, "# EOF")
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestWantsOpenMetrics(t *testing.T) {
+	for accept, want := range map[string]bool{
+		"":           false,
+		"text/plain": false,
+		"application/openmetrics-text; version=1.0.0; charset=utf-8":                      true,
+		"application/openmetrics-text;version=1.0.0;q=0.5,text/plain;version=0.0.4;q=0.4": true,
+		"Application/OpenMetrics-Text":                                                    true,
+		"application/openmetrics-text; q=0, text/plain":                                   false,
+		"application/openmetrics-text;version=1.0.0;q=0.0":                                false,
+		"application/openmetrics-textual":                                                 false,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		req.Header.Set("Accept", accept)
+		if got := wantsOpenMetrics(req); got != want {
+			t.Errorf("wantsOpenMetrics(%q) = %v, want %v", accept, got, want)
+		}
+	}
+}
+
+// readerFromRecorder is an httptest.ResponseRecorder that, like the
+// server's own response writer, implements io.ReaderFrom. Tests copy
+// through io.LimitReader, as http.ServeContent does, so io.Copy reaches
+// ReadFrom instead of the source's WriteTo.
+type readerFromRecorder struct {
+	*httptest.ResponseRecorder
+	readFroms int
+}
+
+func (w *readerFromRecorder) ReadFrom(src io.Reader) (int64, error) {
+	w.readFroms++
+	return io.Copy(w.ResponseRecorder, src)
+}
+
+func TestResponseRecorderReadFrom(t *testing.T) {
+	under := &readerFromRecorder{ResponseRecorder: httptest.NewRecorder()}
+	rec := &responseRecorder{ResponseWriter: under}
+
+	n, err := io.Copy(rec, io.LimitReader(strings.NewReader("hello world"), 11))
+	if err != nil || n != 11 {
+		t.Fatalf("io.Copy = %d, %v", n, err)
+	}
+	if under.readFroms != 1 {
+		t.Errorf("underlying ReadFrom called %d times, want 1", under.readFroms)
+	}
+	if rec.bytes != 11 || rec.status != http.StatusOK || rec.firstByte.IsZero() {
+		t.Errorf("recorder saw %d bytes, status %d, first byte %v", rec.bytes, rec.status, rec.firstByte)
+	}
+	if under.Body.String() != "hello world" {
+		t.Errorf("body = %q", under.Body.String())
+	}
+}
+
+var exemplarSuffix = regexp.MustCompile(` # \{(request_id|trace_id)="[^"]+"\} [0-9.e+-]+ [0-9]+\.[0-9]{3}$`)
+
+func scrapeMetrics(t *testing.T, exemplars bool, accept string) (string, string) {
+	t.Helper()
+	resetMetrics()
+	_, cfg := newTestConfig(t)
+	cfg.metricsExemplars = exemplars
+	r := newRouter(cfg)
+
+	serveRequest(r, httptest.NewRequest(http.MethodGet, "/static/a.txt", nil))
+	traced := httptest.NewRequest(http.MethodGet, "/static/missing.txt", nil)
+	traced.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	serveRequest(r, traced)
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	rec := serveRequest(r, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /metrics = %d", rec.Code)
+	}
+	return rec.Header().Get("Content-Type"), rec.Body.String()
+}
+
+func TestMetricsOpenMetricsExemplars(t *testing.T) {
+	ctype, body := scrapeMetrics(t, true, "application/openmetrics-text; version=1.0.0")
+	if !strings.HasPrefix(ctype, "application/openmetrics-text") {
+		t.Fatalf("Content-Type = %q, want OpenMetrics", ctype)
+	}
+	lines := strings.Split(strings.TrimSuffix(body, "\n"), "\n")
+	if lines[len(lines)-1] != "# EOF" {
+		t.Errorf("last line = %q, want # EOF", lines[len(lines)-1])
+	}
+
+	var exemplars, traceIDs int
+	for _, line := range lines {
+		if strings.HasPrefix(line, "# TYPE ") && strings.HasSuffix(line, " counter") && strings.Contains(line, "_total") {
+			t.Errorf("counter family keeps its _total suffix: %q", line)
+		}
+		if strings.Contains(line, " # {") {
+			if !exemplarSuffix.MatchString(line) {
+				t.Errorf("malformed exemplar: %q", line)
+			}
+			exemplars++
+			if strings.Contains(line, `trace_id="4bf92f3577b34da6a3ce929d0e0e4736"`) {
+				traceIDs++
+			}
+		}
+	}
+	for _, sample := range []string{"static_http_requests_total ", "static_http_responses_total{code=\"200\"} ", "static_http_responses_total{code=\"404\"} ", "static_http_response_bytes_total "} {
+		if !strings.Contains(body, "\n"+sample) {
+			t.Errorf("no %q sample", sample)
+		}
+	}
+	if exemplars == 0 {
+		t.Error("no exemplars with --metrics-exemplars")
+	}
+	if traceIDs == 0 {
+		t.Error("the traceparent request left no trace_id exemplar")
+	}
+}
+
+func TestMetricsPrometheusTextHasNoExemplars(t *testing.T) {
+	for _, c := range []struct {
+		exemplars bool
+		accept    string
+	}{
+		{true, ""},
+		{true, "text/plain"},
+		{false, "application/openmetrics-text"},
+	} {
+		ctype, body := scrapeMetrics(t, c.exemplars, c.accept)
+		if !strings.HasPrefix(ctype, "text/plain; version=0.0.4") {
+			t.Errorf("exemplars=%v Accept %q: Content-Type = %q, want the Prometheus text format", c.exemplars, c.accept, ctype)
+		}
+		if strings.Contains(body, " # {") || strings.Contains(body, "# EOF") {
+			t.Errorf("exemplars=%v Accept %q: Prometheus text carries OpenMetrics syntax", c.exemplars, c.accept)
+		}
+		if !strings.Contains(body, "# TYPE static_http_requests_total counter") {
+			t.Errorf("exemplars=%v Accept %q: counter family lost its _total name", c.exemplars, c.accept)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+	"mime"
+	"strings"
+)
+
+func registerMIMETypes(spec string) error {
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		ext, typ, ok := strings.Cut(pair, "=")
+		ext = strings.TrimSpace(ext)
+		typ = strings.TrimSpace(typ)
+		if !ok || ext == "" || typ == "" {
+			return fmt.Errorf("expected ext=type, got %q", pair)
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		if err := mime.AddExtensionType(ext, typ); err != nil {
+			return fmt.Errorf("%q: %v", pair, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMIMEOverrides(t *testing.T) {
+	if err := registerMIMETypes("webmanifest=application/manifest+json, .statictestext = application/x-static-test"); err != nil {
+		t.Fatal(err)
+	}
+	dir, h := newTestSite(t)
+	writeTestFile(t, filepath.Join(dir, "site.webmanifest"), `{"name": "site"}`)
+	writeTestFile(t, filepath.Join(dir, "data.statictestext"), "data")
+	writeTestFile(t, filepath.Join(dir, "notes.unknownext"), "plain notes")
+
+	cases := []struct {
+		urlPath, defaultContentType, want string
+	}{
+		{"/site.webmanifest", "", "application/manifest+json"},
+		{"/data.statictestext", "", "application/x-static-test"},
+		// Unknown extensions are sniffed, or get --default-content-type.
+		{"/notes.unknownext", "", "text/plain; charset=utf-8"},
+		{"/notes.unknownext", "application/x-default", "application/x-default"},
+	}
+	for _, c := range cases {
+		h.defaultContentType = c.defaultContentType
+		if got := serveRaw(h, c.urlPath, nil).Header().Get("Content-Type"); got != c.want {
+			t.Errorf("GET %s (default %q): Content-Type = %q, want %q", c.urlPath, c.defaultContentType, got, c.want)
+		}
+	}
+}
+
+func TestRegisterMIMETypesErrors(t *testing.T) {
+	for _, spec := range []string{"webmanifest", "=application/json", "json=", "x=not a type"} {
+		if err := registerMIMETypes(spec); err == nil || !strings.Contains(err.Error(), "=") {
+			t.Errorf("registerMIMETypes(%q) = %v, want an error naming the pair", spec, err)
+		}
+	}
+}
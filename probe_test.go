@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHealthProbesBypassLimits(t *testing.T) {
+	_, cfg := newTestConfig(t)
+	cfg.rateLimit = 1
+	cfg.rateBurst = 1
+	cfg.maxConcurrent = 1
+	cfg.queueTimeout = 10 * time.Millisecond
+	cfg.defaultPolicy = "deny"
+	cfg.allowCIDRs, _ = parseCIDRs("192.0.2.1")
+	r := newRouter(cfg)
+
+	get := func(target, remoteAddr string) int {
+		return serveRouter(r, http.MethodGet, target, remoteAddr).Code
+	}
+
+	if code := get("/static/a.txt", "198.51.100.7:1234"); code != http.StatusForbidden {
+		t.Errorf("denied client: GET /static/a.txt = %d, want 403", code)
+	}
+	if code := get("/static/a.txt", "192.0.2.1:1234"); code != http.StatusOK {
+		t.Errorf("allowed client: first GET = %d, want 200", code)
+	}
+	if code := get("/static/a.txt", "192.0.2.1:1234"); code != http.StatusTooManyRequests {
+		t.Errorf("allowed client: second GET = %d, want 429", code)
+	}
+
+	for _, probe := range []string{"/healthz", "/readyz"} {
+		for i := 0; i < 5; i++ {
+			for _, client := range []string{"192.0.2.1:1234", "198.51.100.7:1234"} {
+				if code := get(probe, client); code != http.StatusOK {
+					t.Errorf("GET %s #%d from %s = %d, want 200", probe, i, client, code)
+				}
+			}
+		}
+	}
+
+	// Hold the only --max-concurrent slot with a request that blocks, then
+	// probe.
+	release := make(chan struct{})
+	slot := maxConcurrentMiddleware(1, 10*time.Millisecond)
+	held := slot(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { <-release }))
+	ok := slot(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	go held.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/static/slow.txt", nil))
+	defer close(release)
+	time.Sleep(20 * time.Millisecond)
+
+	busy := httptest.NewRecorder()
+	ok.ServeHTTP(busy, httptest.NewRequest(http.MethodGet, "/static/a.txt", nil))
+	if busy.Code != http.StatusServiceUnavailable {
+		t.Errorf("second request with the slot held = %d, want 503", busy.Code)
+	}
+	probe := httptest.NewRecorder()
+	ok.ServeHTTP(probe, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if probe.Code != http.StatusOK {
+		t.Errorf("/healthz with the slot held = %d, want 200", probe.Code)
+	}
+}
+
+func TestHealthAndReadiness(t *testing.T) {
+	defer ready.Store(true)
+	_, cfg := newTestConfig(t)
+	r := newRouter(cfg)
+
+	cases := []struct {
+		ready      bool
+		target     string
+		wantStatus int
+		wantBody   string
+	}{
+		{false, "/healthz", http.StatusOK, "ok"},
+		{false, "/readyz", http.StatusServiceUnavailable, "not ready"},
+		{true, "/healthz", http.StatusOK, "ok"},
+		{true, "/readyz", http.StatusOK, "ok"},
+	}
+	for _, c := range cases {
+		ready.Store(c.ready)
+		rec := serveRouter(r, http.MethodGet, c.target, "")
+		if rec.Code != c.wantStatus || rec.Body.String() != c.wantBody {
+			t.Errorf("ready=%v: GET %s = %d %q, want %d %q", c.ready, c.target, rec.Code, rec.Body.String(), c.wantStatus, c.wantBody)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// writeLargeTestFile writes size bytes whose values follow their offsets,
+// so any slice of the file can be checked.
+func writeLargeTestFile(t *testing.T, path string, size int) []byte {
+	t.Helper()
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	writeTestFile(t, path, string(data))
+	return data
+}
+
+func TestRangeRequests(t *testing.T) {
+	dir, h := newTestSite(t)
+	const size = 64 << 10
+	data := writeLargeTestFile(t, filepath.Join(dir, "large.bin"), size)
+
+	cases := []struct {
+		rangeHeader string
+		start, end  int
+	}{
+		{"bytes=0-1023", 0, 1023},
+		{"bytes=1024-", 1024, size - 1},
+		{"bytes=-100", size - 100, size - 1},
+	}
+	for _, c := range cases {
+		rec := serveRaw(h, "/large.bin", http.Header{"Range": {c.rangeHeader}})
+		if rec.Code != http.StatusPartialContent {
+			t.Errorf("Range %s = %d, want 206", c.rangeHeader, rec.Code)
+			continue
+		}
+		if got, want := rec.Header().Get("Content-Range"), fmt.Sprintf("bytes %d-%d/%d", c.start, c.end, size); got != want {
+			t.Errorf("Range %s: Content-Range = %q, want %q", c.rangeHeader, got, want)
+		}
+		if got, want := rec.Header().Get("Content-Length"), strconv.Itoa(c.end-c.start+1); got != want {
+			t.Errorf("Range %s: Content-Length = %s, want %s", c.rangeHeader, got, want)
+		}
+		if !bytes.Equal(rec.Body.Bytes(), data[c.start:c.end+1]) {
+			t.Errorf("Range %s: body does not match bytes %d-%d", c.rangeHeader, c.start, c.end)
+		}
+	}
+}
+
+func TestRangeNotSatisfiable(t *testing.T) {
+	dir, h := newTestSite(t)
+	writeLargeTestFile(t, filepath.Join(dir, "large.bin"), 1024)
+
+	rec := serveRaw(h, "/large.bin", http.Header{"Range": {"bytes=4096-"}})
+	if rec.Code != http.StatusRequestedRangeNotSatisfiable {
+		t.Errorf("Range past the end = %d, want 416", rec.Code)
+	}
+	if got := rec.Header().Get("Content-Range"); got != "bytes */1024" {
+		t.Errorf("Content-Range = %q, want %q", got, "bytes */1024")
+	}
+}
+
+func TestMultipartByteranges(t *testing.T) {
+	dir, h := newTestSite(t)
+	const size = 8192
+	data := writeLargeTestFile(t, filepath.Join(dir, "large.bin"), size)
+
+	rec := serveRaw(h, "/large.bin", http.Header{"Range": {"bytes=0-99,1000-1099,-50"}})
+	if rec.Code != http.StatusPartialContent {
+		t.Fatalf("multi-range = %d, want 206", rec.Code)
+	}
+	mediaType, params, err := mime.ParseMediaType(rec.Header().Get("Content-Type"))
+	if err != nil || mediaType != "multipart/byteranges" || params["boundary"] == "" {
+		t.Fatalf("Content-Type = %q, want multipart/byteranges with a boundary", rec.Header().Get("Content-Type"))
+	}
+	if got, want := rec.Header().Get("Content-Length"), strconv.Itoa(rec.Body.Len()); got != want {
+		t.Errorf("Content-Length = %s, body is %s bytes", got, want)
+	}
+
+	want := []struct{ start, end int }{{0, 99}, {1000, 1099}, {size - 50, size - 1}}
+	reader := multipart.NewReader(rec.Body, params["boundary"])
+	for i := 0; ; i++ {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			if i != len(want) {
+				t.Errorf("got %d parts, want %d", i, len(want))
+			}
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i >= len(want) {
+			t.Fatalf("more than %d parts", len(want))
+		}
+
+		w := want[i]
+		if got, wantRange := part.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-%d/%d", w.start, w.end, size); got != wantRange {
+			t.Errorf("part %d: Content-Range = %q, want %q", i, got, wantRange)
+		}
+		if ctype := part.Header.Get("Content-Type"); ctype != "application/octet-stream" {
+			t.Errorf("part %d: Content-Type = %q, want application/octet-stream", i, ctype)
+		}
+		body, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(body, data[w.start:w.end+1]) {
+			t.Errorf("part %d: body does not match bytes %d-%d", i, w.start, w.end)
+		}
+	}
+}
+
+func TestRangeSkipsPrecompressed(t *testing.T) {
+	dir, h := newTestSite(t)
+	data := writeLargeTestFile(t, filepath.Join(dir, "large.bin"), 4096)
+	writeTestFile(t, filepath.Join(dir, "large.bin.gz"), "not really gzip")
+
+	header := http.Header{"Range": {"bytes=0-9"}, "Accept-Encoding": {"gzip"}}
+	rec := serveRaw(h, "/large.bin", header)
+	if rec.Code != http.StatusPartialContent {
+		t.Fatalf("Range with Accept-Encoding = %d, want 206", rec.Code)
+	}
+	if enc := rec.Header().Get("Content-Encoding"); enc != "" {
+		t.Errorf("Content-Encoding = %q, want the identity file", enc)
+	}
+	if !bytes.Equal(rec.Body.Bytes(), data[:10]) {
+		t.Error("body does not match the first 10 bytes of the identity file")
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestRateLimitBurst(t *testing.T) {
+	_, cfg := newTestConfig(t)
+	cfg.rateLimit, cfg.rateBurst = 1, 3
+	r := newRouter(cfg)
+
+	for i := 1; i <= 3; i++ {
+		if rec := serveRouter(r, http.MethodGet, "/static/a.txt", "192.0.2.1:1234"); rec.Code != http.StatusOK {
+			t.Fatalf("request %d within the burst = %d, want 200", i, rec.Code)
+		}
+	}
+	rec := serveRouter(r, http.MethodGet, "/static/a.txt", "192.0.2.1:1234")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("request past the burst = %d, want 429", rec.Code)
+	}
+	if retry, err := strconv.Atoi(rec.Header().Get("Retry-After")); err != nil || retry < 1 {
+		t.Errorf("Retry-After = %q, want a positive number of seconds", rec.Header().Get("Retry-After"))
+	}
+
+	if rec := serveRouter(r, http.MethodGet, "/static/a.txt", "192.0.2.2:1234"); rec.Code != http.StatusOK {
+		t.Errorf("another client = %d, want 200: clients share no bucket", rec.Code)
+	}
+}
+
+func TestRateLimitTrustProxy(t *testing.T) {
+	defer func(saved bool) { trustProxy = saved }(trustProxy)
+	_, cfg := newTestConfig(t)
+	cfg.rateLimit, cfg.rateBurst = 1, 1
+	r := newRouter(cfg)
+
+	get := func(forwardedFor string) int {
+		req := httptest.NewRequest(http.MethodGet, "/static/a.txt", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		return serveRequest(r, req).Code
+	}
+
+	// Behind a proxy every client arrives from its address; only
+	// --trust-proxy tells them apart.
+	trustProxy = true
+	if get("198.51.100.1") != http.StatusOK || get("198.51.100.2") != http.StatusOK {
+		t.Error("--trust-proxy: clients forwarded by one proxy were limited together")
+	}
+	if code := get("198.51.100.1"); code != http.StatusTooManyRequests {
+		t.Errorf("--trust-proxy: repeated forwarded client = %d, want 429", code)
+	}
+
+	trustProxy = false
+	r = newRouter(cfg)
+	get("198.51.100.3")
+	if code := get("198.51.100.4"); code != http.StatusTooManyRequests {
+		t.Errorf("without --trust-proxy: second client from the proxy = %d, want 429", code)
+	}
+}
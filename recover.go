@@ -0,0 +1,31 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"runtime/debug"
+)
+
+// recoverMiddleware turns a panicking handler into a logged 500 instead of
+// a reset connection. It must run inside loggingMiddleware so the failed
+// request is still counted and logged.
+func recoverMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			if err == http.ErrAbortHandler {
+				panic(err)
+			}
+
+			log.Printf("Panic serving %s %s (request %s): %v\n%s", r.Method, r.URL.Path, requestIDFrom(r.Context()), err, debug.Stack())
+			if rec, ok := w.(*responseRecorder); ok && rec.status != 0 {
+				return
+			}
+			httpError(w, r, http.StatusInternalServerError, "Internal server error")
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
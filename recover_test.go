@@ -0,0 +1,50 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRecoverMiddleware(t *testing.T) {
+	var logs syncBuffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	r := newTestRouter(requestIDMiddleware, loggingMiddleware, recoverMiddleware)
+	r.HandleFunc("/panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("deliberate failure")
+	})
+
+	rec := serveRouter(r, http.MethodGet, "/panic", "")
+	if rec.Code != http.StatusInternalServerError || !strings.Contains(rec.Body.String(), "Internal server error") {
+		t.Errorf("GET /panic = %d %q, want a clean 500", rec.Code, rec.Body.String())
+	}
+	got := logs.String()
+	if !strings.Contains(got, "Panic serving GET /panic (request "+rec.Header().Get("X-Request-ID")+"): deliberate failure") {
+		t.Errorf("panic not logged with its request ID:\n%s", got)
+	}
+	if !strings.Contains(got, "goroutine ") {
+		t.Errorf("panic logged without a stack trace:\n%s", got)
+	}
+}
+
+func TestRecoverMiddlewareAfterHeaders(t *testing.T) {
+	var logs syncBuffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	r := newTestRouter(loggingMiddleware, recoverMiddleware)
+	r.HandleFunc("/partial", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("partial"))
+		panic("failed mid-response")
+	})
+
+	// The status is already sent, so the error page must not follow it.
+	rec := serveRouter(r, http.MethodGet, "/partial", "")
+	if rec.Code != http.StatusOK || rec.Body.String() != "partial" {
+		t.Errorf("GET /partial = %d %q, want the partial response untouched", rec.Code, rec.Body.String())
+	}
+}
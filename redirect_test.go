@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPSRedirect(t *testing.T) {
+	cases := []struct {
+		httpsPort, host, target string
+		want                    string
+	}{
+		{"443", "example.com", "/", "https://example.com/"},
+		{"443", "example.com:80", "/static/a.txt?v=2", "https://example.com/static/a.txt?v=2"},
+		{"8443", "example.com:8080", "/docs/", "https://example.com:8443/docs/"},
+		{"443", "[2001:db8::1]:80", "/a", "https://[2001:db8::1]/a"},
+		{"443", "[2001:db8::1]", "/a", "https://[2001:db8::1]/a"},
+		{"8443", "[2001:db8::1]", "/a", "https://[2001:db8::1]:8443/a"},
+		{"8443", "[2001:db8::1]:80", "/a", "https://[2001:db8::1]:8443/a"},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodGet, c.target, nil)
+		req.Host = c.host
+		rec := httptest.NewRecorder()
+		httpsRedirectHandler(c.httpsPort).ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusMovedPermanently {
+			t.Errorf("http://%s%s = %d, want 301", c.host, c.target, rec.Code)
+		}
+		if got := rec.Header().Get("Location"); got != c.want {
+			t.Errorf("http://%s%s: Location = %q, want %q", c.host, c.target, got, c.want)
+		}
+	}
+}
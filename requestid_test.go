@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var generatedRequestID = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestRequestID(t *testing.T) {
+	var fromContext string
+	h := requestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fromContext = requestIDFrom(r.Context())
+	}))
+
+	cases := []struct {
+		name, incoming string
+		passThrough    bool
+	}{
+		{"pass-through", "trace-1234", true},
+		{"generated", "", false},
+		{"too long", strings.Repeat("a", 129), false},
+		{"control characters", "bad\tid", false},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if c.incoming != "" {
+			req.Header.Set("X-Request-ID", c.incoming)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		id := rec.Header().Get("X-Request-ID")
+		if id != fromContext {
+			t.Errorf("%s: response X-Request-ID %q differs from the context's %q", c.name, id, fromContext)
+		}
+		if c.passThrough && id != c.incoming {
+			t.Errorf("%s: X-Request-ID = %q, want the incoming %q", c.name, id, c.incoming)
+		}
+		if !c.passThrough && !generatedRequestID.MatchString(id) {
+			t.Errorf("%s: X-Request-ID = %q, want a generated UUID", c.name, id)
+		}
+	}
+
+	if id := requestIDFrom(httptest.NewRequest(http.MethodGet, "/", nil).Context()); id != "" {
+		t.Errorf("requestIDFrom without the middleware = %q, want empty", id)
+	}
+}
+
+func TestRequestIDInAccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	accessLog.SetOutput(&buf)
+	defer accessLog.SetOutput(io.Discard)
+	_, cfg := newTestConfig(t)
+	r := newRouter(cfg)
+
+	req := httptest.NewRequest(http.MethodGet, "/static/a.txt", nil)
+	req.Header.Set("X-Request-ID", "trace-5678")
+	serveRequest(r, req)
+	if !strings.Contains(buf.String(), "trace-5678") {
+		t.Errorf("access log line %q lacks the request ID", buf.String())
+	}
+}
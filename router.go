@@ -0,0 +1,262 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/netip"
+	"path/filepath"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// routerConfig holds the parsed flags that shape the routes and the
+// middleware chain. main fills it in once the flags have been validated.
+type routerConfig struct {
+	// files carries the settings shared by the static directory and every
+	// mount; its dir is --directory.
+	files    *staticHandler
+	prefix   string
+	mounts   []mount
+	embedded fs.FS // nil unless --embedded
+	rootFile string
+
+	authUsers   map[string]string
+	adminToken  string
+	strictSlash bool
+
+	hideVersion     bool
+	maxRequestSize  int64
+	allowCIDRs      []netip.Prefix
+	denyCIDRs       []netip.Prefix
+	defaultPolicy   string
+	maxConcurrent   int
+	queueTimeout    time.Duration
+	rateLimit       float64
+	rateBurst       int
+	securityHeaders bool
+	csp             string
+	corsOrigins     map[string]bool
+	headers         headerList
+	compression     string
+	compressMinSize int64
+	noCompressExts  map[string]bool
+
+	statsWindow      time.Duration
+	statsTopN        int
+	metrics          bool
+	metricsExemplars bool
+	reloader         *liveReload
+	favicon          bool
+	faviconPath      string
+}
+
+// newRouter registers every route described by cfg and wraps them, and
+// the not-found and method-not-allowed handlers, in the middleware chain.
+func newRouter(cfg *routerConfig) *mux.Router {
+	r := mux.NewRouter().StrictSlash(cfg.strictSlash)
+	// Applied by useMiddleware once all routes are registered, so that the
+	// NotFoundHandler, which serves the SPA index, gets the same chain.
+	middleware := []mux.MiddlewareFunc{
+		requestIDMiddleware,
+		serverHeadersMiddleware(cfg.hideVersion),
+		loggingMiddleware,
+		recoverMiddleware,
+		maxRequestSizeMiddleware(cfg.maxRequestSize),
+	}
+	var postPaths []string
+	if cfg.adminToken != "" {
+		postPaths = append(postPaths, "/stats/reset")
+	}
+	middleware = append(middleware, allowedMethodsMiddleware(len(cfg.corsOrigins) > 0, postPaths...))
+	middleware = append(middleware, drainBodyMiddleware)
+	if len(cfg.allowCIDRs) > 0 || len(cfg.denyCIDRs) > 0 || cfg.defaultPolicy != "allow" {
+		middleware = append(middleware, ipFilterMiddleware(cfg.allowCIDRs, cfg.denyCIDRs, cfg.defaultPolicy))
+	}
+	if cfg.maxConcurrent > 0 {
+		middleware = append(middleware, maxConcurrentMiddleware(cfg.maxConcurrent, cfg.queueTimeout))
+	}
+	if cfg.rateLimit > 0 {
+		middleware = append(middleware, newRateLimiter(cfg.rateLimit, cfg.rateBurst).middleware)
+	}
+	if cfg.securityHeaders {
+		middleware = append(middleware, securityHeadersMiddleware(cfg.csp))
+	}
+	if len(cfg.corsOrigins) > 0 {
+		middleware = append(middleware, corsMiddleware(cfg.corsOrigins))
+	}
+	if len(cfg.headers) > 0 {
+		middleware = append(middleware, customHeadersMiddleware(cfg.headers))
+	}
+	middleware = append(middleware, maintenanceMiddleware(cfg.files.dir))
+	if cfg.compression != "none" {
+		middleware = append(middleware, compressionMiddleware(cfg.compression, cfg.compressMinSize, cfg.noCompressExts))
+	}
+
+	rootFiles := cfg.files
+
+	// requireAuth puts handler behind --auth, if set. Anything that serves
+	// or describes files from the static directory goes through it.
+	requireAuth := func(handler http.Handler) http.Handler {
+		if cfg.authUsers != nil {
+			return basicAuthMiddleware(cfg.authUsers, handler)
+		}
+		return handler
+	}
+	wrapStaticHandler := func(prefix string, files http.Handler) http.Handler {
+		return requireAuth(http.StripPrefix(prefix, files))
+	}
+	newStaticFileHandler := func(prefix, dir string) http.Handler {
+		files := *rootFiles
+		files.dir = dir
+		return wrapStaticHandler(prefix, &files)
+	}
+
+	for _, m := range cfg.mounts {
+		r.PathPrefix(m.prefix).Handler(newStaticFileHandler(m.prefix, m.dir))
+	}
+	r.NotFoundHandler = requireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rootFiles.serveSPAIndex(w, r) {
+			return
+		}
+		httpError(w, r, http.StatusNotFound, "That file was not found")
+	}))
+
+	r.Handle("/", requireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cfg.rootFile != "" {
+			files := *rootFiles
+			files.dir = filepath.Dir(cfg.rootFile)
+			name := filepath.Base(cfg.rootFile)
+			file, stat, err := files.openRegular(name)
+			if errors.Is(err, fs.ErrPermission) {
+				httpError(w, r, http.StatusForbidden, "Access denied")
+				return
+			}
+			if err != nil {
+				httpError(w, r, http.StatusInternalServerError, "Error accessing file")
+				return
+			}
+			defer file.Close()
+			files.serveContent(w, r, name, file, stat)
+			return
+		}
+		if rootFiles.serveSPAIndex(w, r) {
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		defaultIndexPage.Execute(w, serVer)
+	})))
+
+	r.HandleFunc("/stats", serveStats)
+
+	if cfg.adminToken != "" {
+		reset := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestCounts.reset()
+			pathCounts.reset()
+			resetMetrics()
+			serveStats(w, r)
+		})
+		r.Handle("/stats/reset", adminTokenMiddleware(cfg.adminToken, reset)).Methods(http.MethodPost)
+	}
+
+	var integrityRoots []integrityRoot
+	for _, m := range cfg.mounts {
+		files := *rootFiles
+		files.dir = m.dir
+		integrityRoots = append(integrityRoots, integrityRoot{prefix: m.prefix, files: &files})
+	}
+	if cfg.embedded == nil {
+		files := *rootFiles
+		integrityRoots = append(integrityRoots, integrityRoot{prefix: cfg.prefix, files: &files})
+	}
+	r.Handle("/integrity", requireAuth(integrityHandler(integrityRoots, rootFiles.hashes)))
+	if cfg.embedded == nil {
+		r.Handle("/sitemap.xml", requireAuth(sitemapHandler(rootFiles, cfg.prefix)))
+	}
+
+	r.Handle("/stats/files", requireAuth(statsFilesHandler(cfg.statsWindow, cfg.statsTopN)))
+
+	if cfg.metrics {
+		r.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+			if cfg.metricsExemplars && wantsOpenMetrics(r) {
+				w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+				writeMetrics(w, true, true)
+				return
+			}
+			w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+			writeMetrics(w, false, false)
+		})
+	}
+
+	if cfg.reloader != nil {
+		r.Handle(liveReloadPath, cfg.reloader.handler())
+	}
+
+	r.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		io.WriteString(w, "ok")
+	})
+
+	r.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if !ready.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			io.WriteString(w, "not ready")
+			return
+		}
+		io.WriteString(w, "ok")
+	})
+
+	if cfg.favicon {
+		r.HandleFunc("/favicon.ico", func(w http.ResponseWriter, r *http.Request) {
+			serveFavicon(w, r, cfg.faviconPath)
+		})
+	}
+
+	// Registered after the built-in endpoints so that with --prefix / they
+	// still take precedence over files of the same name.
+	if cfg.embedded != nil {
+		r.PathPrefix(cfg.prefix).Handler(wrapStaticHandler(cfg.prefix, &embeddedHandler{
+			fsys:        cfg.embedded,
+			indexFile:   rootFiles.indexFile,
+			cacheRules:  rootFiles.cacheRules,
+			dotfiles:    rootFiles.dotfiles,
+			emitExpires: rootFiles.emitExpires,
+			blockedExts: rootFiles.blockedExts,
+		}))
+	} else {
+		r.PathPrefix(cfg.prefix).Handler(newStaticFileHandler(cfg.prefix, rootFiles.dir))
+	}
+	useMiddleware(r, middleware...)
+	return r
+}
+
+// useMiddleware installs middleware on r the way r.Use does, and also
+// around r's NotFoundHandler and MethodNotAllowedHandler, which mux serves
+// without running any r.Use middleware. Call it once every route and both
+// handlers are set; the first middleware given is the outermost.
+func useMiddleware(r *mux.Router, middleware ...mux.MiddlewareFunc) {
+	r.Use(middleware...)
+
+	notFound := r.NotFoundHandler
+	if notFound == nil {
+		notFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			httpError(w, r, http.StatusNotFound, "That file was not found")
+		})
+	}
+	methodNotAllowed := r.MethodNotAllowedHandler
+	if methodNotAllowed == nil {
+		methodNotAllowed = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			httpError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		})
+	}
+
+	for i := len(middleware) - 1; i >= 0; i-- {
+		notFound = middleware[i](notFound)
+		methodNotAllowed = middleware[i](methodNotAllowed)
+	}
+	r.NotFoundHandler = notFound
+	r.MethodNotAllowedHandler = methodNotAllowed
+}
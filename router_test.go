@@ -0,0 +1,261 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestMain(m *testing.M) {
+	if os.Getenv(runMainEnv) != "" {
+		if interval, err := time.ParseDuration(os.Getenv(dirCheckEnv)); err == nil {
+			dirCheckInterval = interval
+		}
+		main()
+		os.Exit(0)
+	}
+	// Every request through newRouter is access logged; keep test output
+	// to the failures.
+	accessLog.SetOutput(io.Discard)
+	ready.Store(true)
+	os.Exit(m.Run())
+}
+
+// newTestConfig returns the router configuration main builds with the
+// default flags, serving newTestSite's directory under /static/.
+func newTestConfig(t *testing.T) (string, *routerConfig) {
+	t.Helper()
+	dir, files := newTestSite(t)
+	return dir, &routerConfig{
+		files:           files,
+		prefix:          "/static/",
+		strictSlash:     true,
+		maxRequestSize:  1 << 20,
+		defaultPolicy:   "allow",
+		queueTimeout:    5 * time.Second,
+		securityHeaders: true,
+		compression:     "auto",
+		compressMinSize: 1024,
+		noCompressExts:  parseExtensions(defaultNoCompressExts),
+		statsWindow:     60 * time.Second,
+		statsTopN:       10,
+		metrics:         true,
+		favicon:         true,
+	}
+}
+
+// newTestRouter mimics main's layout: one real route, and a
+// NotFoundHandler that answers 200 the way the SPA fallback does.
+func newTestRouter(middleware ...mux.MiddlewareFunc) *mux.Router {
+	r := mux.NewRouter()
+	r.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	})
+	r.HandleFunc("/stats/reset", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "reset")
+	}).Methods(http.MethodPost)
+	r.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "spa index")
+	})
+	useMiddleware(r, middleware...)
+	return r
+}
+
+func serveRouter(h http.Handler, method, target, remoteAddr string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	if remoteAddr != "" {
+		req.RemoteAddr = remoteAddr
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestUseMiddlewareCoversNotFoundHandler(t *testing.T) {
+	deny, err := parseCIDRs("127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newTestRouter(requestIDMiddleware, ipFilterMiddleware(nil, deny, "deny"))
+
+	for _, target := range []string{"/stats", "/app/route"} {
+		rec := serveRouter(r, http.MethodGet, target, "127.0.0.1:1234")
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("denied client: GET %s = %d, want 403", target, rec.Code)
+		}
+		if rec.Header().Get("X-Request-ID") == "" {
+			t.Errorf("GET %s: no X-Request-ID, request ID middleware skipped", target)
+		}
+	}
+}
+
+func TestUseMiddlewareCoversMethodNotAllowedHandler(t *testing.T) {
+	deny, _ := parseCIDRs("127.0.0.1")
+	r := newTestRouter(ipFilterMiddleware(nil, deny, "deny"))
+
+	if rec := serveRouter(r, http.MethodGet, "/stats/reset", "127.0.0.1:1234"); rec.Code != http.StatusForbidden {
+		t.Errorf("denied client: GET /stats/reset = %d, want 403", rec.Code)
+	}
+}
+
+func TestUseMiddlewareOrder(t *testing.T) {
+	var order []string
+	mark := func(name string) mux.MiddlewareFunc {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	r := newTestRouter(mark("outer"), mark("inner"))
+
+	for _, target := range []string{"/stats", "/app/route"} {
+		order = nil
+		serveRouter(r, http.MethodGet, target, "")
+		if len(order) != 2 || order[0] != "outer" || order[1] != "inner" {
+			t.Errorf("GET %s ran middleware %v, want [outer inner]", target, order)
+		}
+	}
+}
+
+func serveRequest(h http.Handler, req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestMountsAreIndependent(t *testing.T) {
+	_, cfg := newTestConfig(t)
+	docs, blog := t.TempDir(), t.TempDir()
+	writeTestFile(t, filepath.Join(docs, "guide.txt"), "docs guide")
+	writeTestFile(t, filepath.Join(docs, "shared.txt"), "docs shared")
+	writeTestFile(t, filepath.Join(blog, "post.txt"), "blog post")
+	writeTestFile(t, filepath.Join(blog, "shared.txt"), "blog shared")
+	cfg.mounts = []mount{{prefix: "/docs/", dir: docs}, {prefix: "/blog/", dir: blog}}
+	r := newRouter(cfg)
+
+	cases := []struct {
+		target     string
+		wantStatus int
+		wantBody   string
+	}{
+		{"/docs/guide.txt", http.StatusOK, "docs guide"},
+		{"/blog/post.txt", http.StatusOK, "blog post"},
+		{"/docs/shared.txt", http.StatusOK, "docs shared"},
+		{"/blog/shared.txt", http.StatusOK, "blog shared"},
+		{"/docs/post.txt", http.StatusNotFound, ""},
+		{"/blog/guide.txt", http.StatusNotFound, ""},
+		{"/docs/a.txt", http.StatusNotFound, ""},
+		{"/static/a.txt", http.StatusOK, "hello"},
+		{"/static/guide.txt", http.StatusNotFound, ""},
+	}
+	for _, c := range cases {
+		rec := serveRouter(r, http.MethodGet, c.target, "")
+		if rec.Code != c.wantStatus {
+			t.Errorf("GET %s = %d, want %d", c.target, rec.Code, c.wantStatus)
+			continue
+		}
+		if c.wantBody != "" && rec.Body.String() != c.wantBody {
+			t.Errorf("GET %s = %q, want %q", c.target, rec.Body.String(), c.wantBody)
+		}
+	}
+}
+
+func TestRootFile(t *testing.T) {
+	_, cfg := newTestConfig(t)
+	home := filepath.Join(t.TempDir(), "home.html")
+	writeTestFile(t, home, "<h1>home</h1>")
+
+	rec := serveRouter(newRouter(cfg), http.MethodGet, "/", "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Static Server") {
+		t.Errorf("without --root-file: GET / = %d %q, want the built-in page", rec.Code, rec.Body.String())
+	}
+
+	cfg.rootFile = home
+	rec = serveRouter(newRouter(cfg), http.MethodGet, "/", "")
+	if rec.Code != http.StatusOK || rec.Body.String() != "<h1>home</h1>" {
+		t.Errorf("--root-file: GET / = %d %q, want the file", rec.Code, rec.Body.String())
+	}
+	if ctype := rec.Header().Get("Content-Type"); ctype != "text/html; charset=utf-8" {
+		t.Errorf("--root-file: Content-Type = %q, want text/html; charset=utf-8", ctype)
+	}
+
+	cfg.rootFile = filepath.Join(t.TempDir(), "missing.html")
+	if rec := serveRouter(newRouter(cfg), http.MethodGet, "/", ""); rec.Code != http.StatusInternalServerError {
+		t.Errorf("missing --root-file: GET / = %d, want 500", rec.Code)
+	}
+}
+
+func TestStrictSlash(t *testing.T) {
+	dir, cfg := newTestConfig(t)
+	writeTestFile(t, filepath.Join(dir, "docs", "index.html"), "docs")
+
+	cases := []struct {
+		strict       bool
+		target       string
+		wantStatus   int
+		wantLocation string
+	}{
+		{true, "/stats/", http.StatusMovedPermanently, "/stats"},
+		{false, "/stats/", http.StatusNotFound, ""},
+		{true, "/integrity/", http.StatusMovedPermanently, "/integrity"},
+		{false, "/integrity/", http.StatusNotFound, ""},
+		// Directory index redirects come from the static handler, so they
+		// happen either way.
+		{true, "/static/docs", http.StatusMovedPermanently, "docs/"},
+		{false, "/static/docs", http.StatusMovedPermanently, "docs/"},
+	}
+	for _, c := range cases {
+		cfg.strictSlash = c.strict
+		rec := serveRouter(newRouter(cfg), http.MethodGet, c.target, "")
+		if rec.Code != c.wantStatus || rec.Header().Get("Location") != c.wantLocation {
+			t.Errorf("--strict-slash=%v: GET %s = %d Location %q, want %d %q",
+				c.strict, c.target, rec.Code, rec.Header().Get("Location"), c.wantStatus, c.wantLocation)
+		}
+	}
+}
+
+func TestPrefix(t *testing.T) {
+	_, cfg := newTestConfig(t)
+	cases := []struct {
+		prefix, target string
+		wantStatus     int
+		wantBody       string
+	}{
+		{"/assets/", "/assets/a.txt", http.StatusOK, "hello"},
+		{"/assets/", "/assets/sub/b.txt", http.StatusOK, "nested"},
+		{"/assets/", "/static/a.txt", http.StatusNotFound, ""},
+		{"/", "/a.txt", http.StatusOK, "hello"},
+		{"/", "/sub/b.txt", http.StatusOK, "nested"},
+		// Built-in pages win on exact matches.
+		{"/", "/healthz", http.StatusOK, "ok"},
+	}
+	for _, c := range cases {
+		cfg.prefix = c.prefix
+		rec := serveRouter(newRouter(cfg), http.MethodGet, c.target, "")
+		if rec.Code != c.wantStatus {
+			t.Errorf("--prefix %s: GET %s = %d, want %d", c.prefix, c.target, rec.Code, c.wantStatus)
+			continue
+		}
+		if c.wantBody != "" && rec.Body.String() != c.wantBody {
+			t.Errorf("--prefix %s: GET %s = %q, want %q", c.prefix, c.target, rec.Body.String(), c.wantBody)
+		}
+	}
+
+	// /stats is registered before the prefix handler, so it is the built-in
+	// JSON even when the directory has a file of that name.
+	dir, cfg := newTestConfig(t)
+	cfg.prefix = "/"
+	writeTestFile(t, filepath.Join(dir, "stats"), "file")
+	if rec := serveRouter(newRouter(cfg), http.MethodGet, "/stats", ""); rec.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("--prefix /: GET /stats = %q, want the built-in stats", rec.Body.String())
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	_, cfg := newTestConfig(t)
+	cfg.csp = "default-src 'self'"
+	want := map[string]string{
+		"X-Content-Type-Options":  "nosniff",
+		"X-Frame-Options":         "DENY",
+		"Referrer-Policy":         "no-referrer",
+		"Content-Security-Policy": "default-src 'self'",
+	}
+
+	for _, enabled := range []bool{true, false} {
+		cfg.securityHeaders = enabled
+		r := newRouter(cfg)
+		for _, target := range []string{"/static/a.txt", "/", "/static/missing.txt"} {
+			rec := serveRouter(r, http.MethodGet, target, "")
+			for name, value := range want {
+				got := rec.Header().Get(name)
+				if enabled && got != value {
+					t.Errorf("GET %s: %s = %q, want %q", target, name, got, value)
+				}
+				// http.Error sets nosniff on error pages by itself.
+				if !enabled && got != "" && rec.Code == http.StatusOK {
+					t.Errorf("--security-headers=false: GET %s sent %s: %q", target, name, got)
+				}
+			}
+		}
+	}
+
+	cfg.securityHeaders, cfg.csp = true, ""
+	if got := serveRouter(newRouter(cfg), http.MethodGet, "/", "").Header().Get("Content-Security-Policy"); got != "" {
+		t.Errorf("without --csp: Content-Security-Policy = %q, want none", got)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/xml"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+type sitemapFile struct {
+	path    string
+	modTime time.Time
+}
+
+// sitemapCache holds the files found by the last walk of the static
+// directory, along with the mtime of every directory visited. Adding,
+// removing or renaming a file changes its directory's mtime, so the walk
+// is only repeated when one of those differs.
+type sitemapCache struct {
+	mu       sync.Mutex
+	files    []sitemapFile
+	dirTimes map[string]time.Time
+}
+
+func (c *sitemapCache) stale() bool {
+	if c.dirTimes == nil {
+		return true
+	}
+	for dir, modTime := range c.dirTimes {
+		stat, err := os.Stat(dir)
+		if err != nil || !stat.ModTime().Equal(modTime) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *sitemapCache) list(h *staticHandler) ([]sitemapFile, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.stale() {
+		return c.files, nil
+	}
+
+	var files []sitemapFile
+	dirTimes := map[string]time.Time{}
+	err := filepath.WalkDir(h.dir, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(h.dir, filePath)
+		if err != nil {
+			return err
+		}
+		urlPath := filepath.ToSlash(rel)
+		if rel != "." && !h.dotfiles && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			dirTimes[filePath] = info.ModTime()
+			return nil
+		}
+		if !info.Mode().IsRegular() || isPrecompressedSibling(filePath) || hasBlockedExt(h.blockedExts, filePath) {
+			return nil
+		}
+		if h.maxFileSize > 0 && info.Size() > h.maxFileSize {
+			return nil
+		}
+		files = append(files, sitemapFile{path: urlPath, modTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c.files, c.dirTimes = files, dirTimes
+	return files, nil
+}
+
+// isPrecompressedSibling reports whether filePath is a .gz or .br copy of
+// another file, which is served in its place rather than on its own.
+func isPrecompressedSibling(filePath string) bool {
+	for _, variant := range precompressedVariants {
+		if base, ok := strings.CutSuffix(filePath, variant.ext); ok {
+			if _, err := os.Stat(base); err == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod"`
+}
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+func sitemapHandler(h *staticHandler, prefix string) http.HandlerFunc {
+	cache := &sitemapCache{}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		files, err := cache.list(h)
+		if err != nil {
+			httpError(w, r, http.StatusInternalServerError, "Error reading directory")
+			return
+		}
+
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		} else if trustProxy && r.Header.Get("X-Forwarded-Proto") == "https" {
+			scheme = "https"
+		}
+
+		set := sitemapURLSet{Xmlns: "http://www.sitemaps.org/schemas/sitemap/0.9"}
+		for _, f := range files {
+			loc := url.URL{Scheme: scheme, Host: r.Host, Path: path.Join(prefix, f.path)}
+			if dir, name := path.Split(f.path); name == h.indexFile {
+				// Directory indexes are listed under the directory URL.
+				loc.Path = prefix + dir
+			}
+			set.URLs = append(set.URLs, sitemapURL{
+				Loc:     loc.String(),
+				LastMod: f.modTime.UTC().Format(time.RFC3339),
+			})
+		}
+
+		out, err := xml.MarshalIndent(set, "", "  ")
+		if err != nil {
+			httpError(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Write([]byte(xml.Header))
+		w.Write(out)
+	}
+}
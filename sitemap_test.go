@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSitemap(t *testing.T) {
+	dir, cfg := newTestConfig(t)
+	writeTestFile(t, filepath.Join(dir, "sub", "index.html"), "sub index")
+	writeTestFile(t, filepath.Join(dir, "a.txt.gz"), "gzipped")
+	writeTestFile(t, filepath.Join(dir, ".env"), "secret")
+	writeTestFile(t, filepath.Join(dir, ".git", "config"), "secret")
+	r := newRouter(cfg)
+
+	rec := serveRouter(r, http.MethodGet, "/sitemap.xml", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /sitemap.xml = %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/xml; charset=utf-8" {
+		t.Errorf("Content-Type = %q, want application/xml", ct)
+	}
+	body := rec.Body.String()
+	if !strings.HasPrefix(body, xml.Header) {
+		t.Errorf("sitemap lacks the XML declaration:\n%s", body)
+	}
+
+	var set sitemapURLSet
+	if err := xml.Unmarshal(rec.Body.Bytes(), &set); err != nil {
+		t.Fatalf("sitemap is not valid XML: %v\n%s", err, body)
+	}
+	if set.XMLName.Local != "urlset" || set.XMLName.Space != "http://www.sitemaps.org/schemas/sitemap/0.9" {
+		t.Errorf("root element = %+v, want a sitemaps.org urlset", set.XMLName)
+	}
+
+	var locs []string
+	for _, u := range set.URLs {
+		locs = append(locs, u.Loc)
+		if _, err := time.Parse(time.RFC3339, u.LastMod); err != nil {
+			t.Errorf("lastmod for %s = %q, want RFC 3339: %v", u.Loc, u.LastMod, err)
+		}
+	}
+	want := []string{
+		"http://example.com/static/a.txt",
+		"http://example.com/static/",
+		"http://example.com/static/sub/b.txt",
+		"http://example.com/static/sub/",
+	}
+	if !reflect.DeepEqual(locs, want) {
+		t.Errorf("sitemap locations = %q, want %q", locs, want)
+	}
+}
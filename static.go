@@ -0,0 +1,495 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+type staticHandler struct {
+	dir        string
+	indexFile  string
+	cacheRules map[string]int
+	spa        bool
+	dev        bool
+	dotfiles   bool
+
+	listingTemplate *template.Template
+	templates       *templateCache
+	liveReload      bool
+	fallback        *originFallback
+	noSniff         bool
+	followSymlinks  bool
+
+	defaultContentType string
+	maxFileSize        int64
+	bufferSize         int64
+	emitExpires        bool
+	blockedExts        map[string]bool
+	bandwidth          *bandwidthLimiter
+	etagMode           string
+	hashes             *integrityCache
+}
+
+func (h *staticHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !h.dotfiles && hasDotComponent(r.URL.Path) {
+		httpError(w, r, http.StatusNotFound, "File not found")
+		return
+	}
+	if hasBlockedExt(h.blockedExts, r.URL.Path) {
+		httpError(w, r, http.StatusForbidden, "Access denied")
+		return
+	}
+
+	filePath, ok := resolvePath(h.dir, r.URL.Path)
+	if !ok {
+		httpError(w, r, http.StatusForbidden, "Access denied")
+		return
+	}
+
+	name := rootName(r.URL.Path)
+	file, err := h.open(name)
+	if err != nil {
+		if !isNotExist(err) {
+			httpError(w, r, http.StatusForbidden, "Access denied")
+			return
+		}
+		if h.fallback != nil && h.fallback.serve(w, r, filePath) {
+			return
+		}
+		if h.serveSPAIndex(w, r) {
+			return
+		}
+		httpError(w, r, http.StatusNotFound, "File not found")
+		return
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		httpError(w, r, http.StatusInternalServerError, "Error accessing file")
+		return
+	}
+
+	if stat.IsDir() {
+		indexName := path.Join(name, h.indexFile)
+		index, indexStat, err := h.openRegular(indexName)
+		if err != nil && !isNotExist(err) {
+			httpError(w, r, http.StatusForbidden, "Access denied")
+			return
+		}
+		if err != nil && !h.dev {
+			httpError(w, r, http.StatusForbidden, "Directory listing is not allowed")
+			return
+		}
+		if err == nil {
+			defer index.Close()
+		}
+
+		if r.URL.Path != "" && !strings.HasSuffix(r.URL.Path, "/") {
+			redirectToSlash(w, r)
+			return
+		}
+
+		if err != nil {
+			h.serveListing(w, r, file)
+			return
+		}
+		name, file, stat = indexName, index, indexStat
+	}
+
+	h.serveContent(w, r, name, file, stat)
+}
+
+// open opens name, a slash-separated path relative to the served
+// directory, through an os.Root so that neither ".." nor a symlink can
+// reach outside it. With --follow-symlinks only the lexical check made by
+// resolvePath applies.
+//
+// os.Root refuses every absolute symlink, even one pointing back inside
+// the directory, so when it refuses name the link is resolved here and,
+// if the target is inside the directory, opened through the root by its
+// resolved name.
+func (h *staticHandler) open(name string) (*os.File, error) {
+	if h.followSymlinks {
+		filePath, ok := resolvePath(h.dir, name)
+		if !ok {
+			return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrPermission}
+		}
+		return os.Open(filePath)
+	}
+
+	// The root is opened per call rather than held open, so a directory
+	// that is replaced, e.g. a volume that is remounted, is picked up.
+	root, err := os.OpenRoot(h.dir)
+	if err != nil {
+		return nil, err
+	}
+	defer root.Close()
+	file, err := root.Open(filepath.FromSlash(name))
+	if err != nil && !isNotExist(err) {
+		if resolved, ok := h.resolveInside(name); ok {
+			return root.Open(resolved)
+		}
+	}
+	return file, err
+}
+
+// resolveInside follows every symlink in name and returns the result
+// relative to the served directory, or false if it lands outside it.
+func (h *staticHandler) resolveInside(name string) (string, bool) {
+	filePath, ok := resolvePath(h.dir, name)
+	if !ok {
+		return "", false
+	}
+	resolved, err := filepath.EvalSymlinks(filePath)
+	if err != nil {
+		return "", false
+	}
+	dir, err := filepath.EvalSymlinks(h.dir)
+	if err != nil {
+		return "", false
+	}
+	dir, _ = filepath.Abs(dir)
+	resolved, _ = filepath.Abs(resolved)
+
+	rel, err := filepath.Rel(dir, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return rel, true
+}
+
+// openRegular is open for files only; directories are reported as not
+// existing. Files with a --block-ext extension are refused here as well as
+// by URL, since the index, the SPA fallback and --root-file are opened
+// under names the request never mentions.
+func (h *staticHandler) openRegular(name string) (*os.File, os.FileInfo, error) {
+	if hasBlockedExt(h.blockedExts, name) {
+		return nil, nil, &os.PathError{Op: "open", Path: name, Err: os.ErrPermission}
+	}
+	file, err := h.open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stat, err := file.Stat()
+	if err == nil && stat.IsDir() {
+		err = &os.PathError{Op: "open", Path: name, Err: errIsDirectory}
+	}
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	return file, stat, nil
+}
+
+var errIsDirectory = fmt.Errorf("is a directory: %w", fs.ErrNotExist)
+
+// rootName turns a request path into the form os.Root expects. Any ".."
+// is left in place for the root to reject.
+func rootName(urlPath string) string {
+	name := strings.TrimPrefix(urlPath, "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+// isNotExist reports whether err means there is no file to serve, as
+// opposed to one the server may not serve.
+func isNotExist(err error) bool {
+	return errors.Is(err, fs.ErrNotExist) || errors.Is(err, syscall.ENOTDIR)
+}
+
+func (h *staticHandler) serveSPAIndex(w http.ResponseWriter, r *http.Request) bool {
+	// API clients asking for JSON get a JSON 404 rather than the app shell.
+	if !h.spa || path.Ext(r.URL.Path) != "" || prefersJSON(r) {
+		return false
+	}
+
+	index, stat, err := h.openRegular(h.indexFile)
+	if err != nil {
+		return false
+	}
+	defer index.Close()
+
+	h.serveContent(w, r, h.indexFile, index, stat)
+	return true
+}
+
+var precompressedVariants = []struct {
+	encoding string
+	ext      string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// serveContent sends file, which was opened as filePath relative to the
+// served directory.
+func (h *staticHandler) serveContent(w http.ResponseWriter, r *http.Request, filePath string, file *os.File, stat os.FileInfo) {
+	name := stat.Name()
+
+	if h.maxFileSize > 0 && stat.Size() > h.maxFileSize {
+		httpError(w, r, http.StatusForbidden, "File exceeds the maximum file size")
+		return
+	}
+
+	if h.templates != nil && isTemplateFile(name) {
+		h.serveTemplate(w, r, filePath, file, stat)
+		return
+	}
+	if h.liveReload && isHTML(mime.TypeByExtension(filepath.Ext(name))) {
+		h.serveInjected(w, r, file, stat)
+		return
+	}
+
+	addVary(w.Header(), "Accept-Encoding")
+	// Range requests get the identity file: a multipart/byteranges body
+	// cut from a .gz or .br sibling cannot carry a Content-Encoding.
+	acceptEncoding := r.Header.Get("Accept-Encoding")
+	if r.Header.Get("Range") != "" {
+		acceptEncoding = ""
+	}
+	hashKey := filepath.Join(h.dir, filepath.FromSlash(filePath))
+	if compressed, compressedStat, encoding := h.openPrecompressed(filePath, acceptEncoding); compressed != nil {
+		defer compressed.Close()
+		w.Header().Set("Content-Type", mime.TypeByExtension(filepath.Ext(name)))
+		w.Header().Set("Content-Encoding", encoding)
+		file, stat = compressed, compressedStat
+		hashKey += ";" + encoding
+	}
+
+	if h.defaultContentType != "" && w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", h.typeByExtension(name))
+	}
+	if h.noSniff {
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", h.typeByExtension(name))
+		}
+	}
+
+	if h.dev {
+		w.Header().Set("Cache-Control", "no-store")
+	} else {
+		if etag := h.etag(hashKey, file, stat); etag != "" {
+			w.Header().Set("ETag", etag)
+		}
+		setCacheHeaders(w.Header(), h.cacheRules, name, h.emitExpires)
+	}
+
+	var content io.ReadSeeker = file
+	if h.bufferSize > 0 && stat.Size() <= h.bufferSize {
+		// Small files are read up front so the body goes out in a single
+		// write together with the headers.
+		data, err := io.ReadAll(file)
+		if err != nil {
+			httpError(w, r, http.StatusInternalServerError, "Error reading file")
+			return
+		}
+		content = bytes.NewReader(data)
+	}
+
+	if h.bandwidth != nil {
+		w = &throttledWriter{ResponseWriter: w, ctx: r.Context(), limiter: h.bandwidth}
+	}
+	ew := &errorWriter{ResponseWriter: w}
+	http.ServeContent(ew, r, name, stat.ModTime(), content)
+	logWriteError(r, ew.err)
+}
+
+func (h *staticHandler) serveInjected(w http.ResponseWriter, r *http.Request, file *os.File, stat os.FileInfo) {
+	body, err := io.ReadAll(file)
+	if err != nil {
+		httpError(w, r, http.StatusInternalServerError, "Error reading file")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	http.ServeContent(w, r, stat.Name(), stat.ModTime(), bytes.NewReader(injectLiveReload(body)))
+}
+
+// typeByExtension returns the Content-Type for name without looking at the
+// file contents, falling back to --default-content-type and then to
+// application/octet-stream for unknown extensions.
+func (h *staticHandler) typeByExtension(name string) string {
+	if ctype := mime.TypeByExtension(filepath.Ext(name)); ctype != "" {
+		return ctype
+	}
+	if h.defaultContentType != "" {
+		return h.defaultContentType
+	}
+	return "application/octet-stream"
+}
+
+func isHTML(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return mediaType == "text/html"
+}
+
+func (h *staticHandler) openPrecompressed(filePath, acceptEncoding string) (*os.File, os.FileInfo, string) {
+	if mime.TypeByExtension(filepath.Ext(filePath)) == "" {
+		return nil, nil, ""
+	}
+
+	for _, variant := range precompressedVariants {
+		if !acceptsEncoding(acceptEncoding, variant.encoding) {
+			continue
+		}
+		if file, stat, err := h.openRegular(filePath + variant.ext); err == nil {
+			return file, stat, variant.encoding
+		}
+	}
+	return nil, nil, ""
+}
+
+func openRegularFile(indexPath string) (*os.File, os.FileInfo, error) {
+	index, err := os.Open(indexPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stat, err := index.Stat()
+	if err == nil && stat.IsDir() {
+		err = errors.New("is a directory")
+	}
+	if err != nil {
+		index.Close()
+		return nil, nil, err
+	}
+	return index, stat, nil
+}
+
+func resolvePath(dir, urlPath string) (string, bool) {
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return "", false
+	}
+
+	filePath := filepath.Join(root, filepath.FromSlash(urlPath))
+	rel, err := filepath.Rel(root, filePath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+
+	return filePath, true
+}
+
+func hasDotComponent(urlPath string) bool {
+	for _, part := range strings.Split(urlPath, "/") {
+		if strings.HasPrefix(part, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// parseExtensions turns a comma-separated list such as "go,.env, CONF"
+// into a set of lower-case extensions without the leading dot.
+func parseExtensions(spec string) map[string]bool {
+	exts := map[string]bool{}
+	for _, ext := range strings.Split(spec, ",") {
+		ext = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(ext), "."))
+		if ext != "" {
+			exts[ext] = true
+		}
+	}
+	return exts
+}
+
+func hasBlockedExt(exts map[string]bool, name string) bool {
+	return exts[strings.ToLower(strings.TrimPrefix(path.Ext(name), "."))]
+}
+
+func fileETag(stat os.FileInfo) string {
+	return fmt.Sprintf(`"%x-%x"`, stat.ModTime().UnixNano(), stat.Size())
+}
+
+func validETagMode(mode string) error {
+	switch mode {
+	case "mtime", "hash", "off":
+		return nil
+	}
+	return fmt.Errorf("unknown --etag-mode %q (expected mtime, hash or off)", mode)
+}
+
+// etag returns the ETag for --etag-mode: the mtime and size, a hash of the
+// contents that survives a redeploy touching every file, or nothing.
+func (h *staticHandler) etag(key string, file *os.File, stat os.FileInfo) string {
+	switch h.etagMode {
+	case "off":
+		return ""
+	case "hash":
+		hash, err := h.hashes.hashFile(key, file, stat)
+		if _, seekErr := file.Seek(0, io.SeekStart); seekErr != nil && err == nil {
+			err = seekErr
+		}
+		if err != nil {
+			log.Printf("Error hashing %s for its ETag: %v", key, err)
+			return ""
+		}
+		return `"` + hash + `"`
+	}
+	return fileETag(stat)
+}
+
+func redirectToSlash(w http.ResponseWriter, r *http.Request) {
+	target := path.Base(r.URL.Path) + "/"
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+	w.Header().Set("Location", target)
+	w.WriteHeader(http.StatusMovedPermanently)
+}
+
+type mount struct {
+	prefix string
+	dir    string
+}
+
+type mountList []mount
+
+func (m *mountList) String() string {
+	parts := make([]string, len(*m))
+	for i, mt := range *m {
+		parts[i] = mt.prefix + "=" + mt.dir
+	}
+	return strings.Join(parts, ",")
+}
+
+func (m *mountList) Set(value string) error {
+	prefix, dir, ok := strings.Cut(value, "=")
+	if !ok || prefix == "" || dir == "" {
+		return fmt.Errorf("expected /prefix=/path/to/dir, got %q", value)
+	}
+
+	prefix = cleanPrefix(prefix)
+	if prefix == "/" {
+		return fmt.Errorf("mount prefix cannot be the root")
+	}
+	*m = append(*m, mount{prefix: prefix, dir: dir})
+	return nil
+}
+
+// cleanPrefix turns a URL prefix into the /name/ form used for routing.
+func cleanPrefix(prefix string) string {
+	trimmed := strings.Trim(path.Clean("/"+prefix), "/")
+	if trimmed == "" {
+		return "/"
+	}
+	return "/" + trimmed + "/"
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestSite creates a served directory with a few files and returns it
+// together with a handler for it.
+func newTestSite(t *testing.T) (string, *staticHandler) {
+	t.Helper()
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "index.html"), "index")
+	writeTestFile(t, filepath.Join(dir, "a.txt"), "hello")
+	writeTestFile(t, filepath.Join(dir, "sub", "b.txt"), "nested")
+	return dir, &staticHandler{dir: dir, indexFile: "index.html", etagMode: "mtime", hashes: newIntegrityCache()}
+}
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// serveRaw calls h with urlPath as the already-decoded request path, the
+// way it arrives after http.StripPrefix, so nothing cleans it first.
+func serveRaw(h http.Handler, urlPath string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.URL.Path = urlPath
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestResolvePathRejectsEscapes(t *testing.T) {
+	dir := t.TempDir()
+	for _, urlPath := range []string{"..", "../etc/passwd", "/../../etc/passwd", "sub/../../secret"} {
+		if _, ok := resolvePath(dir, urlPath); ok {
+			t.Errorf("resolvePath(%q) = ok, want rejected", urlPath)
+		}
+	}
+	for _, urlPath := range []string{"", "/", "a.txt", "/sub/../a.txt", "/etc/passwd"} {
+		filePath, ok := resolvePath(dir, urlPath)
+		if !ok {
+			t.Errorf("resolvePath(%q) rejected, want a path inside %s", urlPath, dir)
+			continue
+		}
+		if rel, err := filepath.Rel(dir, filePath); err != nil || rel == ".." || filepath.IsAbs(rel) {
+			t.Errorf("resolvePath(%q) = %s, outside %s", urlPath, filePath, dir)
+		}
+	}
+}
+
+func TestStaticHandlerTraversal(t *testing.T) {
+	dir, h := newTestSite(t)
+	writeTestFile(t, filepath.Join(filepath.Dir(dir), "secret.txt"), "secret")
+
+	// ".." is a dot component, so it is refused as a hidden path before the
+	// containment check; with --serve-dotfiles the containment check does it.
+	for _, dotfiles := range []bool{false, true} {
+		h.dotfiles = dotfiles
+		want := http.StatusNotFound
+		if dotfiles {
+			want = http.StatusForbidden
+		}
+		for _, urlPath := range []string{"../secret.txt", "/../secret.txt", "sub/../../secret.txt"} {
+			if rec := serveRaw(h, urlPath, nil); rec.Code != want {
+				t.Errorf("dotfiles=%v: GET %q = %d, want %d", dotfiles, urlPath, rec.Code, want)
+			}
+		}
+	}
+}
+
+func TestStaticHandlerEncodedTraversal(t *testing.T) {
+	dir, h := newTestSite(t)
+	writeTestFile(t, filepath.Join(filepath.Dir(dir), "secret.txt"), "secret")
+	srv := httptest.NewServer(http.StripPrefix("/static/", h))
+	defer srv.Close()
+
+	for _, rawPath := range []string{"/static/%2e%2e/secret.txt", "/static/%2E%2E%2Fsecret.txt", "/static/..%2fsecret.txt"} {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+		req.URL.Opaque = rawPath
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			t.Errorf("GET %s = 200, want it refused", rawPath)
+		}
+	}
+}
+
+func TestStaticHandlerAbsolutePath(t *testing.T) {
+	_, h := newTestSite(t)
+
+	// An absolute file system path in the URL is looked up inside the
+	// served directory, not at the root of the file system.
+	rec := serveRaw(h, "/etc/passwd", nil)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("GET /etc/passwd = %d, want 404", rec.Code)
+	}
+	if rec := serveRaw(h, "/a.txt", nil); rec.Code != http.StatusOK || rec.Body.String() != "hello" {
+		t.Errorf("GET /a.txt = %d %q, want 200 hello", rec.Code, rec.Body.String())
+	}
+}
+
+func TestDotfiles(t *testing.T) {
+	dir, h := newTestSite(t)
+	writeTestFile(t, filepath.Join(dir, ".env"), "SECRET=1")
+	writeTestFile(t, filepath.Join(dir, ".git", "config"), "[core]")
+	writeTestFile(t, filepath.Join(dir, "sub", ".hidden"), "hidden")
+	hidden := []string{"/.env", "/.git/config", "/sub/.hidden", "/.git/"}
+
+	for _, path := range hidden {
+		if rec := serveRaw(h, path, nil); rec.Code != http.StatusNotFound {
+			t.Errorf("GET %s = %d, want 404", path, rec.Code)
+		}
+	}
+
+	h.dev = true
+	listing := serveRaw(h, "/sub/", nil)
+	if listing.Code != http.StatusOK || strings.Contains(listing.Body.String(), ".hidden") {
+		t.Errorf("listing of /sub/ = %d, shows .hidden: %v", listing.Code, strings.Contains(listing.Body.String(), ".hidden"))
+	}
+
+	h.dotfiles = true
+	for _, path := range hidden[:3] {
+		if rec := serveRaw(h, path, nil); rec.Code != http.StatusOK {
+			t.Errorf("--serve-dotfiles: GET %s = %d, want 200", path, rec.Code)
+		}
+	}
+	if listing := serveRaw(h, "/sub/", nil); !strings.Contains(listing.Body.String(), ".hidden") {
+		t.Error("--serve-dotfiles: listing of /sub/ leaves out .hidden")
+	}
+}
+
+// BenchmarkServeSmallFile compares sending a small file straight from disk
+// with reading it up front under --buffer-size, over a real connection so
+// the header and body writes reach the socket.
+func BenchmarkServeSmallFile(b *testing.B) {
+	dir := b.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "small.css"), bytes.Repeat([]byte("a{}"), 1024), 0644); err != nil {
+		b.Fatal(err)
+	}
+
+	for _, bufferSize := range []int64{0, 64 << 10} {
+		h := &staticHandler{dir: dir, indexFile: "index.html", etagMode: "mtime", hashes: newIntegrityCache(), bufferSize: bufferSize}
+		b.Run(fmt.Sprintf("buffer=%d", bufferSize), func(b *testing.B) {
+			server := httptest.NewServer(h)
+			defer server.Close()
+			client := server.Client()
+
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				resp, err := client.Get(server.URL + "/small.css")
+				if err != nil {
+					b.Fatal(err)
+				}
+				io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+				if resp.StatusCode != http.StatusOK {
+					b.Fatalf("GET /small.css = %d", resp.StatusCode)
+				}
+			}
+		})
+	}
+}
+
+func TestBlockedExtensionOpenedUnderAnotherName(t *testing.T) {
+	dir, cfg := newTestConfig(t)
+	writeTestFile(t, filepath.Join(dir, "index.php"), "<?php secret();")
+	writeTestFile(t, filepath.Join(dir, "sub", "index.php"), "<?php secret();")
+	cfg.files.indexFile = "index.php"
+	cfg.files.blockedExts = parseExtensions("php")
+
+	for _, target := range []string{"/", "/sub/", "/index.php"} {
+		rec := serveRaw(cfg.files, target, nil)
+		if rec.Code != http.StatusForbidden || strings.Contains(rec.Body.String(), "secret") {
+			t.Errorf("GET %s with a blocked index = %d %q, want 403", target, rec.Code, rec.Body.String())
+		}
+	}
+
+	cfg.files.spa = true
+	r := newRouter(cfg)
+	if rec := serveRequest(r, httptest.NewRequest(http.MethodGet, "/app/route", nil)); strings.Contains(rec.Body.String(), "secret") {
+		t.Errorf("SPA fallback served the blocked index: %d", rec.Code)
+	}
+
+	cfg.files.spa = false
+	cfg.rootFile = filepath.Join(dir, "index.php")
+	r = newRouter(cfg)
+	if rec := serveRequest(r, httptest.NewRequest(http.MethodGet, "/", nil)); rec.Code != http.StatusForbidden {
+		t.Errorf("GET / with a blocked --root-file = %d, want 403", rec.Code)
+	}
+}
+
+func TestDirectoryIndex(t *testing.T) {
+	dir, h := newTestSite(t)
+	writeTestFile(t, filepath.Join(dir, "docs", "index.html"), "docs index")
+	writeTestFile(t, filepath.Join(dir, "docs", "home.htm"), "docs home")
+	writeTestFile(t, filepath.Join(dir, "empty", "a.txt"), "not an index")
+
+	cases := []struct {
+		indexFile, urlPath string
+		wantStatus         int
+		wantBody           string
+	}{
+		{"index.html", "/docs/", http.StatusOK, "docs index"},
+		{"index.html", "/empty/", http.StatusForbidden, ""},
+		{"home.htm", "/docs/", http.StatusOK, "docs home"},
+		{"home.htm", "/empty/", http.StatusForbidden, ""},
+	}
+	for _, c := range cases {
+		h.indexFile = c.indexFile
+		rec := serveRaw(h, c.urlPath, nil)
+		if rec.Code != c.wantStatus {
+			t.Errorf("--index %s: %s = %d, want %d", c.indexFile, c.urlPath, rec.Code, c.wantStatus)
+			continue
+		}
+		if c.wantBody != "" && rec.Body.String() != c.wantBody {
+			t.Errorf("--index %s: %s body = %q, want %q", c.indexFile, c.urlPath, rec.Body.String(), c.wantBody)
+		}
+	}
+}
+
+func TestDevModeListings(t *testing.T) {
+	dir, h := newTestSite(t)
+	writeTestFile(t, filepath.Join(dir, "files", "report.txt"), "report")
+
+	for _, dev := range []bool{false, true} {
+		h.dev = dev
+		rec := serveRaw(h, "/files/", nil)
+		listed := rec.Code == http.StatusOK && strings.Contains(rec.Body.String(), "report.txt")
+		if listed != dev {
+			t.Errorf("--dev=%v: GET /files/ = %d %q; listed %v, want %v", dev, rec.Code, rec.Body.String(), listed, dev)
+		}
+
+		rec = serveRaw(h, "/a.txt", nil)
+		if got := rec.Header().Get("Cache-Control") == "no-store"; got != dev {
+			t.Errorf("--dev=%v: Cache-Control = %q", dev, rec.Header().Get("Cache-Control"))
+		}
+		if got := rec.Header().Get("ETag") == ""; got != dev {
+			t.Errorf("--dev=%v: ETag = %q", dev, rec.Header().Get("ETag"))
+		}
+	}
+}
+
+func TestNoSniff(t *testing.T) {
+	dir, h := newTestSite(t)
+	writeTestFile(t, filepath.Join(dir, "README"), "plain text without an extension")
+	writeTestFile(t, filepath.Join(dir, "page"), "<!DOCTYPE html><p>html without an extension</p>")
+
+	cases := []struct {
+		urlPath  string
+		noSniff  bool
+		wantType string
+	}{
+		{"/README", false, "text/plain; charset=utf-8"},
+		{"/page", false, "text/html; charset=utf-8"},
+		{"/README", true, "application/octet-stream"},
+		{"/page", true, "application/octet-stream"},
+		{"/a.txt", true, "text/plain; charset=utf-8"},
+	}
+	for _, c := range cases {
+		h.noSniff = c.noSniff
+		rec := serveRaw(h, c.urlPath, nil)
+		if got := rec.Header().Get("Content-Type"); got != c.wantType {
+			t.Errorf("--no-sniff=%v: GET %s Content-Type = %q, want %q", c.noSniff, c.urlPath, got, c.wantType)
+		}
+		if got := rec.Header().Get("X-Content-Type-Options") == "nosniff"; got != c.noSniff {
+			t.Errorf("--no-sniff=%v: GET %s X-Content-Type-Options = %q", c.noSniff, c.urlPath, rec.Header().Get("X-Content-Type-Options"))
+		}
+	}
+}
+
+func TestDefaultContentType(t *testing.T) {
+	dir, h := newTestSite(t)
+	// Sniffing takes the NUL byte for binary data.
+	writeTestFile(t, filepath.Join(dir, "README"), "\x00read me")
+
+	for _, c := range []struct {
+		defaultContentType, urlPath, want string
+	}{
+		{"", "/README", "application/octet-stream"},
+		{"text/plain; charset=utf-8", "/README", "text/plain; charset=utf-8"},
+		{"text/plain; charset=utf-8", "/index.html", "text/html; charset=utf-8"},
+	} {
+		h.defaultContentType = c.defaultContentType
+		if got := serveRaw(h, c.urlPath, nil).Header().Get("Content-Type"); got != c.want {
+			t.Errorf("--default-content-type %q: GET %s Content-Type = %q, want %q", c.defaultContentType, c.urlPath, got, c.want)
+		}
+	}
+}
+
+func TestMaxFileSize(t *testing.T) {
+	dir, h := newTestSite(t)
+	h.maxFileSize = 10
+	writeTestFile(t, filepath.Join(dir, "under.txt"), "123456789")
+	writeTestFile(t, filepath.Join(dir, "limit.txt"), "1234567890")
+	writeTestFile(t, filepath.Join(dir, "over.txt"), "12345678901")
+
+	for _, c := range []struct {
+		path string
+		want int
+	}{
+		{"/under.txt", http.StatusOK},
+		{"/limit.txt", http.StatusOK},
+		{"/over.txt", http.StatusForbidden},
+	} {
+		rec := serveRaw(h, c.path, nil)
+		if rec.Code != c.want {
+			t.Errorf("GET %s with a 10 byte limit = %d, want %d", c.path, rec.Code, c.want)
+		}
+		if c.want == http.StatusForbidden && strings.Contains(rec.Body.String(), "12345678901") {
+			t.Errorf("GET %s leaked the oversized file: %q", c.path, rec.Body.String())
+		}
+	}
+
+	h.maxFileSize = 0
+	if rec := serveRaw(h, "/over.txt", nil); rec.Code != http.StatusOK {
+		t.Errorf("GET /over.txt with no limit = %d, want 200", rec.Code)
+	}
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatsFilesRequiresAuth(t *testing.T) {
+	_, cfg := newTestConfig(t)
+	cfg.authUsers = map[string]string{"u": "p"}
+	r := newRouter(cfg)
+	serveRequest(r, newAuthRequest("/static/a.txt", "u", "p"))
+
+	if rec := serveRequest(r, httptest.NewRequest(http.MethodGet, "/stats/files", nil)); rec.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous GET /stats/files = %d, want 401", rec.Code)
+	}
+
+	rec := serveRequest(r, newAuthRequest("/stats/files", "u", "p"))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("authenticated GET /stats/files = %d, want 200", rec.Code)
+	}
+	var body struct {
+		Window string
+		Files  []pathHits
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Window != "1m0s" {
+		t.Errorf("Window = %q, want 1m0s", body.Window)
+	}
+}
+
+func TestStatsSnapshot(t *testing.T) {
+	s := stats()
+	if s.RAMBytes == 0 {
+		t.Error("RAMBytes = 0")
+	}
+	if s.Goroutines < 1 {
+		t.Errorf("Goroutines = %d, want at least 1", s.Goroutines)
+	}
+	if s.MaxProcs < 1 || s.NumCPU < 1 {
+		t.Errorf("MaxProcs = %d, NumCPU = %d, want at least 1", s.MaxProcs, s.NumCPU)
+	}
+	if s.CPUPercent < 0 {
+		t.Errorf("CPUPercent = %v, want >= 0", s.CPUPercent)
+	}
+}
+
+func TestCPUUsage(t *testing.T) {
+	if _, ok := processCPUTime(); !ok {
+		t.Skip("process CPU time is not available on this platform")
+	}
+	go sampleCPU(20 * time.Millisecond)
+
+	// Keep a core busy until the sampler has seen it.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+		}
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for cpuUsage() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	_, cfg := newTestConfig(t)
+	rec := serveRequest(newRouter(cfg), httptest.NewRequest(http.MethodGet, "/stats", nil))
+	var data map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &data); err != nil {
+		t.Fatal(err)
+	}
+	percent, ok := data["CPU Usage (%)"].(float64)
+	if max := 100 * float64(runtime.NumCPU()); !ok || percent <= 0 || percent > max {
+		t.Errorf("CPU Usage (%%) = %v while busy, want a percentage in (0, %v]", data["CPU Usage (%)"], max)
+	}
+}
+
+func TestStatsJSON(t *testing.T) {
+	_, cfg := newTestConfig(t)
+	rec := serveRequest(newRouter(cfg), httptest.NewRequest(http.MethodGet, "/stats", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("GET /stats = %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	var data map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &data); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"Name", "Version", "Uptime", "Threads", "CPU Usage (%)", "Goroutines",
+		"Active Connections", "Ram Usage", "Requests (60s)", "Bytes Served",
+		"Bytes Served (uncompressed)", "Bytes Served (compressed)",
+		"Compression Ratio", "Requests Per Second",
+	}
+	for _, key := range want {
+		if _, ok := data[key]; !ok {
+			t.Errorf("/stats has no %q", key)
+		}
+	}
+	if len(data) != len(want) {
+		t.Errorf("/stats has %d keys, want %d: %v", len(data), len(want), data)
+	}
+	if g, ok := data["Goroutines"].(float64); !ok || g < 1 {
+		t.Errorf("Goroutines = %v, want a count", data["Goroutines"])
+	}
+}
+
+func TestBytesServedCounter(t *testing.T) {
+	dir, cfg := newTestConfig(t)
+	const size = 5000
+	writeLargeTestFile(t, filepath.Join(dir, "known.bin"), size)
+	r := newRouter(cfg)
+
+	before := bytesServed()
+	if rec := serveRouter(r, http.MethodGet, "/static/known.bin", ""); rec.Code != http.StatusOK || rec.Body.Len() != size {
+		t.Fatalf("GET /static/known.bin = %d with %d bytes", rec.Code, rec.Body.Len())
+	}
+	if got := bytesServed() - before; got != size {
+		t.Errorf("bytes served grew by %d after a %d byte download", got, size)
+	}
+
+	before = bytesServed()
+	serveRouter(r, http.MethodHead, "/static/known.bin", "")
+	if got := bytesServed() - before; got != 0 {
+		t.Errorf("bytes served grew by %d after a HEAD", got)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	cases := []struct {
+		b    uint64
+		want string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1536, "1.50 KiB"},
+		{5 << 20, "5.00 MiB"},
+		{3 << 30, "3.00 GiB"},
+	}
+	for _, c := range cases {
+		if got := formatBytes(c.b); got != c.want {
+			t.Errorf("formatBytes(%d) = %q, want %q", c.b, got, c.want)
+		}
+	}
+}
+
+func TestStatsCompressionRatio(t *testing.T) {
+	defer resetMetrics()
+	resetMetrics()
+	dir, cfg := newTestConfig(t)
+	css := strings.Repeat("body { margin: 0; }\n", 500)
+	writeTestFile(t, filepath.Join(dir, "site.css"), css)
+	r := newRouter(cfg)
+
+	if got := compressionRatio(compressionStats()); got != "n/a" {
+		t.Errorf("ratio before any compression = %q, want n/a", got)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/static/site.css", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := serveRequest(r, req)
+	uncompressed, compressed := compressionStats()
+	if uncompressed != uint64(len(css)) || compressed != uint64(rec.Body.Len()) {
+		t.Errorf("compression counters = %d/%d, want %d/%d", uncompressed, compressed, len(css), rec.Body.Len())
+	}
+
+	rec = serveRequest(r, httptest.NewRequest(http.MethodGet, "/stats", nil))
+	var data map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &data); err != nil {
+		t.Fatal(err)
+	}
+	ratio, _ := data["Compression Ratio"].(string)
+	percent, err := strconv.ParseFloat(strings.TrimSuffix(ratio, "%"), 64)
+	if err != nil || percent <= 0 || percent >= 100 {
+		t.Errorf("Compression Ratio = %q, want a percentage below 100%%", data["Compression Ratio"])
+	}
+}
+
+func TestStatsReset(t *testing.T) {
+	_, cfg := newTestConfig(t)
+	cfg.adminToken = "secret"
+	r := newRouter(cfg)
+	decode := func(rec *httptest.ResponseRecorder) map[string]interface{} {
+		t.Helper()
+		var data map[string]interface{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &data); err != nil {
+			t.Fatalf("%v: %s", err, rec.Body)
+		}
+		return data
+	}
+
+	for i := 0; i < 3; i++ {
+		serveRouter(r, http.MethodGet, "/static/a.txt", "")
+	}
+	if n := decode(serveRouter(r, http.MethodGet, "/stats", ""))["Requests (60s)"].(float64); n < 3 {
+		t.Fatalf("Requests (60s) = %v after 3 downloads", n)
+	}
+
+	for _, auth := range []string{"", "Bearer wrong", "Basic secret"} {
+		req := httptest.NewRequest(http.MethodPost, "/stats/reset", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		if rec := serveRequest(r, req); rec.Code != http.StatusUnauthorized {
+			t.Errorf("POST /stats/reset with Authorization %q = %d, want 401", auth, rec.Code)
+		}
+	}
+	if rec := serveRouter(r, http.MethodGet, "/stats/reset", ""); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET /stats/reset = %d, want 405", rec.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/stats/reset", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := serveRequest(r, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST /stats/reset with the token = %d, want 200", rec.Code)
+	}
+	// The response is built after the reset and before the reset request
+	// itself is counted.
+	data := decode(rec)
+	if data["Requests (60s)"] != 0.0 || data["Bytes Served"] != "0 B" {
+		t.Errorf("reset response has Requests (60s) %v and Bytes Served %v, want 0", data["Requests (60s)"], data["Bytes Served"])
+	}
+}
+
+func TestStatsExclude(t *testing.T) {
+	defer func(saved []string) { statsExclude = saved }(statsExclude)
+	statsExclude = parsePathList("/stats, healthz ,/metrics")
+	_, cfg := newTestConfig(t)
+	cfg.adminToken = "secret"
+	r := newRouter(cfg)
+
+	req := httptest.NewRequest(http.MethodPost, "/stats/reset", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	serveRequest(r, req)
+	requests := func() float64 {
+		t.Helper()
+		var data map[string]interface{}
+		if err := json.Unmarshal(serveRouter(r, http.MethodGet, "/stats", "").Body.Bytes(), &data); err != nil {
+			t.Fatal(err)
+		}
+		return data["Requests (60s)"].(float64)
+	}
+
+	for i := 0; i < 5; i++ {
+		serveRouter(r, http.MethodGet, "/healthz", "")
+		serveRouter(r, http.MethodGet, "/metrics", "")
+		serveRouter(r, http.MethodGet, "/stats/files", "")
+		serveRouter(r, http.MethodGet, "/favicon.ico", "")
+	}
+	if n := requests(); n != 0 {
+		t.Errorf("Requests (60s) = %v after only excluded requests, want 0", n)
+	}
+	serveRouter(r, http.MethodGet, "/static/a.txt", "")
+	if n := requests(); n != 1 {
+		t.Errorf("Requests (60s) = %v after one download, want 1", n)
+	}
+
+	statsExclude = nil
+	before := requests()
+	if n := requests(); n <= before {
+		t.Errorf("with nothing excluded, Requests (60s) went from %v to %v across a /stats request", before, n)
+	}
+}
+
+func TestCountsInStats(t *testing.T) {
+	defer func(saved []string) { statsExclude = saved }(statsExclude)
+	statsExclude = parsePathList("/stats,/healthz,/admin/")
+	for _, c := range []struct {
+		path string
+		want bool
+	}{
+		{"/stats", false},
+		{"/stats/files", false},
+		{"/statsfoo", true},
+		{"/healthz", false},
+		{"/admin", true},
+		{"/admin/users", false},
+		{"/favicon.ico", false},
+		{"/static/a.txt", true},
+	} {
+		if got := countsInStats(c.path); got != c.want {
+			t.Errorf("countsInStats(%q) = %v, want %v", c.path, got, c.want)
+		}
+	}
+}
+
+func TestStatsActiveConnections(t *testing.T) {
+	_, cfg := newTestConfig(t)
+	srv := httptest.NewUnstartedServer(newRouter(cfg))
+	srv.Config.ConnState = trackConnState
+	srv.Start()
+	defer srv.Close()
+	base := activeConnections.Load()
+
+	waitFor := func(want int64) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for activeConnections.Load() != want {
+			if time.Now().After(deadline) {
+				t.Fatalf("active connections = %d, want %d", activeConnections.Load(), want)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	var conns []net.Conn
+	for i := 0; i < 3; i++ {
+		conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		conns = append(conns, conn)
+	}
+	waitFor(base + 3)
+
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	resp, err := client.Get(srv.URL + "/stats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var data map[string]interface{}
+	err = json.NewDecoder(resp.Body).Decode(&data)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The three idle connections plus the one asking.
+	if got := data["Active Connections"]; got != float64(base+4) {
+		t.Errorf("Active Connections = %v, want %d", got, base+4)
+	}
+
+	for _, conn := range conns {
+		conn.Close()
+	}
+	waitFor(base)
+}
+
+func TestStatsPretty(t *testing.T) {
+	_, cfg := newTestConfig(t)
+	r := newRouter(cfg)
+
+	for _, c := range []struct {
+		target string
+		pretty bool
+	}{
+		{"/stats", false},
+		{"/stats?pretty=false", false},
+		{"/stats?pretty=true", true},
+		{"/stats?pretty=1", true},
+	} {
+		body := serveRouter(r, http.MethodGet, c.target, "").Body.String()
+		if !json.Valid([]byte(body)) {
+			t.Errorf("GET %s is not JSON: %q", c.target, body)
+			continue
+		}
+		indented := strings.Contains(body, "\n  \"Name\": ")
+		if indented != c.pretty || strings.Contains(body, "\n") != c.pretty {
+			t.Errorf("GET %s: indented %v, want %v:\n%s", c.target, indented, c.pretty, body)
+		}
+	}
+}
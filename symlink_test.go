@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newSymlinkSite adds links to newTestSite's a.txt, relative and absolute,
+// and one to a file outside the served directory.
+func newSymlinkSite(t *testing.T) *staticHandler {
+	t.Helper()
+	dir, h := newTestSite(t)
+	outside := filepath.Join(t.TempDir(), "secret.txt")
+	writeTestFile(t, outside, "secret")
+
+	links := map[string]string{
+		"rel.txt":     "a.txt",
+		"abs.txt":     filepath.Join(dir, "a.txt"),
+		"sub/up.txt":  "../a.txt",
+		"outside.txt": outside,
+		"subdir":      filepath.Join(dir, "sub"),
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(dir, filepath.FromSlash(name))); err != nil {
+			t.Skipf("symlinks not supported: %v", err)
+		}
+	}
+	return h
+}
+
+func TestSymlinksInsideRoot(t *testing.T) {
+	h := newSymlinkSite(t)
+
+	for path, want := range map[string]string{
+		"/rel.txt":      "hello",
+		"/abs.txt":      "hello",
+		"/sub/up.txt":   "hello",
+		"/subdir/b.txt": "nested",
+	} {
+		rec := serveRaw(h, path, nil)
+		if rec.Code != http.StatusOK || rec.Body.String() != want {
+			t.Errorf("GET %s = %d %q, want 200 %q", path, rec.Code, rec.Body.String(), want)
+		}
+	}
+}
+
+func TestSymlinkOutsideRoot(t *testing.T) {
+	h := newSymlinkSite(t)
+
+	rec := serveRaw(h, "/outside.txt", nil)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("GET /outside.txt = %d, want 403", rec.Code)
+	}
+
+	h.followSymlinks = true
+	rec = serveRaw(h, "/outside.txt", nil)
+	if rec.Code != http.StatusOK || rec.Body.String() != "secret" {
+		t.Errorf("--follow-symlinks: GET /outside.txt = %d %q, want 200 \"secret\"", rec.Code, rec.Body.String())
+	}
+}
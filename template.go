@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+type cachedTemplate struct {
+	modTime time.Time
+	tmpl    *template.Template
+}
+
+// templateCache holds parsed .html templates for --template mode, keyed by
+// file path and reparsed whenever the file's mtime changes.
+type templateCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedTemplate
+}
+
+func newTemplateCache() *templateCache {
+	return &templateCache{entries: map[string]cachedTemplate{}}
+}
+
+func isTemplateFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".html", ".htm":
+		return true
+	}
+	return false
+}
+
+func (c *templateCache) get(key string, file *os.File, stat os.FileInfo, funcs template.FuncMap) (*template.Template, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if entry, ok := c.entries[key]; ok && entry.modTime.Equal(stat.ModTime()) {
+		return entry.tmpl, nil
+	}
+
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(file); err != nil {
+		return nil, err
+	}
+	tmpl, err := template.New(stat.Name()).Funcs(funcs).Parse(buf.String())
+	if err != nil {
+		return nil, err
+	}
+	c.entries[key] = cachedTemplate{modTime: stat.ModTime(), tmpl: tmpl}
+	return tmpl, nil
+}
+
+// templateFuncs returns the helpers available to a template. Relative
+// include paths are resolved against the directory of the template itself,
+// absolute ones against the served directory; neither may leave it.
+func (h *staticHandler) templateFuncs(filePath string) template.FuncMap {
+	dir := path.Dir(filePath)
+
+	return template.FuncMap{
+		"include": func(name string) (template.HTML, error) {
+			urlPath := name
+			if !strings.HasPrefix(urlPath, "/") {
+				urlPath = path.Join("/", dir, urlPath)
+			}
+			if !h.dotfiles && hasDotComponent(urlPath) {
+				return "", fmt.Errorf("include %q: file not found", name)
+			}
+			if _, ok := resolvePath(h.dir, urlPath); !ok {
+				return "", fmt.Errorf("include %q: access denied", name)
+			}
+			file, _, err := h.openRegular(rootName(urlPath))
+			if err != nil {
+				return "", fmt.Errorf("include %q: %w", name, err)
+			}
+			defer file.Close()
+			data, err := io.ReadAll(file)
+			if err != nil {
+				return "", fmt.Errorf("include %q: %w", name, err)
+			}
+			return template.HTML(data), nil
+		},
+		"buildTime": func() string {
+			return startTime.Format(time.RFC3339)
+		},
+	}
+}
+
+func (h *staticHandler) serveTemplate(w http.ResponseWriter, r *http.Request, filePath string, file *os.File, stat os.FileInfo) {
+	key := filepath.Join(h.dir, filepath.FromSlash(filePath))
+	tmpl, err := h.templates.get(key, file, stat, h.templateFuncs(filePath))
+	if err != nil {
+		log.Printf("Error parsing template %s: %v", key, err)
+		httpError(w, r, http.StatusInternalServerError, "Error rendering template")
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, nil); err != nil {
+		log.Printf("Error rendering template %s: %v", key, err)
+		httpError(w, r, http.StatusInternalServerError, "Error rendering template")
+		return
+	}
+
+	body := buf.Bytes()
+	if h.liveReload {
+		body = injectLiveReload(body)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if h.dev {
+		w.Header().Set("Cache-Control", "no-store")
+	} else {
+		setCacheHeaders(w.Header(), h.cacheRules, stat.Name(), h.emitExpires)
+	}
+	http.ServeContent(w, r, stat.Name(), time.Time{}, bytes.NewReader(body))
+}
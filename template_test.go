@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTemplateMode(t *testing.T) {
+	dir, h := newTestSite(t)
+	h.templates = newTemplateCache()
+	writeTestFile(t, filepath.Join(dir, "partials", "header.html"), "<header>site</header>")
+	writeTestFile(t, filepath.Join(dir, "page.html"), `{{include "/partials/header.html"}}<main>page</main>`)
+	writeTestFile(t, filepath.Join(dir, "partials", "page.html"), `{{include "header.html"}}<p>relative</p>`)
+	writeTestFile(t, filepath.Join(dir, "plain.html"), "<p>plain</p>")
+	writeTestFile(t, filepath.Join(dir, "script.js"), `let s = "{{include \"/partials/header.html\"}}";`)
+	writeTestFile(t, filepath.Join(dir, "escape.html"), `{{include "../../etc/passwd"}}`)
+	writeTestFile(t, filepath.Join(dir, "hidden.html"), `{{include "/.env"}}`)
+	writeTestFile(t, filepath.Join(dir, ".env"), "SECRET=1")
+
+	cases := []struct {
+		urlPath    string
+		wantStatus int
+		wantBody   string
+	}{
+		{"/page.html", http.StatusOK, "<header>site</header><main>page</main>"},
+		{"/partials/page.html", http.StatusOK, "<header>site</header><p>relative</p>"},
+		{"/plain.html", http.StatusOK, "<p>plain</p>"},
+		{"/script.js", http.StatusOK, `let s = "{{include \"/partials/header.html\"}}";`},
+		{"/escape.html", http.StatusInternalServerError, ""},
+		{"/hidden.html", http.StatusInternalServerError, ""},
+	}
+	for _, c := range cases {
+		rec := serveRaw(h, c.urlPath, nil)
+		if rec.Code != c.wantStatus {
+			t.Errorf("GET %s = %d, want %d", c.urlPath, rec.Code, c.wantStatus)
+			continue
+		}
+		if c.wantBody != "" && rec.Body.String() != c.wantBody {
+			t.Errorf("GET %s = %q, want %q", c.urlPath, rec.Body.String(), c.wantBody)
+		}
+	}
+
+	h.templates = nil
+	if rec := serveRaw(h, "/page.html", nil); rec.Body.String() != `{{include "/partials/header.html"}}<main>page</main>` {
+		t.Errorf("without --template: GET /page.html = %q, want the file as is", rec.Body.String())
+	}
+}
+
+func TestTemplateCacheInvalidatedOnChange(t *testing.T) {
+	dir, h := newTestSite(t)
+	h.templates = newTemplateCache()
+	page := filepath.Join(dir, "page.html")
+	writeTestFile(t, page, "<p>one</p>")
+	if got := serveRaw(h, "/page.html", nil).Body.String(); got != "<p>one</p>" {
+		t.Fatalf("first render = %q", got)
+	}
+
+	writeTestFile(t, page, "<p>two</p>")
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(page, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if got := serveRaw(h, "/page.html", nil).Body.String(); got != "<p>two</p>" {
+		t.Errorf("render after the file changed = %q, want the new contents", got)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+func watchDirectory(dir string, onChange func(fsnotify.Event)) (*fsnotify.Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if err := addWatchRecursive(watcher, dir); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	go func() {
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				onChange(event)
+				if event.Has(fsnotify.Create) {
+					if stat, err := os.Stat(event.Name); err == nil && stat.IsDir() {
+						if err := addWatchRecursive(watcher, event.Name); err != nil {
+							log.Printf("Error watching %s: %v", event.Name, err)
+						}
+					}
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Printf("Error watching files: %v", err)
+			}
+		}
+	}()
+	return watcher, nil
+}
+
+// addWatchRecursive watches dir and every directory below it, since
+// fsnotify only reports events for a directory's direct children.
+func addWatchRecursive(watcher *fsnotify.Watcher, dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return watcher.Add(path)
+		}
+		return nil
+	})
+}
+
+func logFileEvent(event fsnotify.Event) {
+	switch {
+	case event.Has(fsnotify.Create):
+		log.Printf("File created: %s", event.Name)
+	case event.Has(fsnotify.Write):
+		log.Printf("File modified: %s", event.Name)
+	case event.Has(fsnotify.Remove), event.Has(fsnotify.Rename):
+		log.Printf("File deleted: %s", event.Name)
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWatchLogsFileChanges(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "existing", "old.txt"), "old")
+	_, _, logs := startServer(t, "--directory", dir, "--watch")
+
+	created := filepath.Join(dir, "new.txt")
+	writeTestFile(t, created, "new")
+	waitForLog(t, logs, "File created: "+created)
+
+	nested := filepath.Join(dir, "existing", "old.txt")
+	if err := os.WriteFile(nested, []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitForLog(t, logs, "File modified: "+nested)
+
+	if err := os.Remove(created); err != nil {
+		t.Fatal(err)
+	}
+	waitForLog(t, logs, "File deleted: "+created)
+}